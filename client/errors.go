@@ -0,0 +1,140 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorCode is the machine-readable code of an error returned by the daemon.
+type ErrorCode string
+
+const (
+	// CodeInvalidRequest: the request is malformed or fails validation.
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	// CodeUnsupportedType: the event type is neither "keyboard" nor "consumer".
+	CodeUnsupportedType ErrorCode = "unsupported_type"
+	// CodeOutOfRange: the code doesn't fit the event type (keyboard codes
+	// are 8-bit).
+	CodeOutOfRange ErrorCode = "code_out_of_range"
+	// CodeUnknownDevice: no bridge has the requested name.
+	CodeUnknownDevice ErrorCode = "unknown_device"
+	// CodeDeviceDisconnected: the bridge isn't connected, or its serial port
+	// failed while sending.
+	CodeDeviceDisconnected ErrorCode = "device_disconnected"
+	// CodeQueueTimeout: the event couldn't be queued or written within the
+	// daemon's -send-timeout, e.g. because another client holds the bridge.
+	CodeQueueTimeout ErrorCode = "queue_timeout"
+	// CodeDeviceClosed: the bridge was shut down, because the daemon is
+	// stopping or the bridge was removed by a configuration reload.
+	CodeDeviceClosed     ErrorCode = "device_closed"
+	CodeUnauthorized     ErrorCode = "unauthorized"
+	CodeForbidden        ErrorCode = "forbidden"
+	CodeMethodNotAllowed ErrorCode = "method_not_allowed"
+	CodeInternal         ErrorCode = "internal_error"
+)
+
+// Sentinel errors for matching with errors.Is: an *Error is one of these if
+// it has the same Code.
+var (
+	ErrInvalidRequest     = &Error{Code: CodeInvalidRequest}
+	ErrUnsupportedType    = &Error{Code: CodeUnsupportedType}
+	ErrCodeOutOfRange     = &Error{Code: CodeOutOfRange}
+	ErrUnknownDevice      = &Error{Code: CodeUnknownDevice}
+	ErrDeviceDisconnected = &Error{Code: CodeDeviceDisconnected}
+	ErrQueueTimeout       = &Error{Code: CodeQueueTimeout}
+	ErrDeviceClosed       = &Error{Code: CodeDeviceClosed}
+	ErrUnauthorized       = &Error{Code: CodeUnauthorized}
+	ErrForbidden          = &Error{Code: CodeForbidden}
+)
+
+// ErrorResponse matches the body of every error response.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail is the `error` object of an ErrorResponse.
+type ErrorDetail struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// NotSent is set when the daemon failed the request before sending
+	// anything to the bridge, because it was busy or disconnected.
+	NotSent bool `json:"not_sent,omitempty"`
+}
+
+// Error is an error returned by the daemon. Use errors.As to inspect it, or
+// errors.Is with the Err* sentinels to match its Code.
+type Error struct {
+	// StatusCode is the HTTP status of the response, zero for errors
+	// acknowledging stream frames.
+	StatusCode int
+	// Code is empty if the response wasn't a JSON error, e.g. from a proxy.
+	Code    ErrorCode
+	Message string
+	// NotSent is set when no key event of the request reached the bridge,
+	// so sending it again can't repeat a keystroke.
+	NotSent bool
+}
+
+func (e *Error) Error() string {
+	code := string(e.Code)
+	if code == "" && e.StatusCode != 0 {
+		code = "HTTP " + strconv.Itoa(e.StatusCode)
+	}
+	switch {
+	case e.Message == "":
+		return code
+	case code == "":
+		return e.Message
+	default:
+		return e.Message + " (" + code + ")"
+	}
+}
+
+// Is reports whether target is an *Error with the same Code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// Retryable reports whether the request may succeed if sent again later:
+// the bridge was disconnected or busy. Validation errors aren't retryable.
+func (e *Error) Retryable() bool {
+	switch e.Code {
+	case CodeDeviceDisconnected, CodeQueueTimeout:
+		return true
+	}
+	return false
+}
+
+// IsRetryable reports whether err wraps a Retryable *Error.
+func IsRetryable(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Retryable()
+}
+
+// IsNotSent reports whether err guarantees that nothing reached the bridge:
+// the daemon failed the request before sending it (Error.NotSent), or the
+// request never reached the daemon because connecting to it failed.
+func IsNotSent(err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.NotSent
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// responseError reads the error of a non-200 response.
+func responseError(resp *http.Response) *Error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var decoded ErrorResponse
+	if json.Unmarshal(body, &decoded) == nil && decoded.Error.Code != "" {
+		return &Error{StatusCode: resp.StatusCode, Code: decoded.Error.Code, Message: decoded.Error.Message, NotSent: decoded.Error.NotSent}
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
@@ -0,0 +1,21 @@
+package client
+
+import "time"
+
+// Device events posted to webhooks.
+const (
+	EventFound        = "found"
+	EventLost         = "lost"
+	EventConnected    = "connected"
+	EventDisconnected = "disconnected"
+)
+
+// DeviceEvent is the JSON body the daemon POSTs to each `-webhook` URL when
+// a bridge changes state.
+type DeviceEvent struct {
+	Device string    `json:"device"`
+	Event  string    `json:"event"`
+	Port   string    `json:"port,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	Time   time.Time `json:"time"`
+}
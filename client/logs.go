@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogEntry is a device log line, as sent by `GET /logs/stream`.
+type LogEntry struct {
+	Device string    `json:"device"`
+	Time   time.Time `json:"time"`
+	Text   string    `json:"text"`
+	// Truncated is set when the line was split because it was too long.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// LogsRequest selects the lines returned by Logs.
+type LogsRequest struct {
+	// Device restricts the lines to one bridge (empty for all of them).
+	Device string
+	// Since keeps only lines read after this time (zero for all of them).
+	Since time.Time
+	// Limit keeps only the last Limit lines (0 for all of them).
+	Limit int
+}
+
+// LogsResponse matches the `GET /logs` response body.
+type LogsResponse struct {
+	Lines []LogEntry `json:"lines"`
+}
+
+// Logs returns the recent device log lines kept by the daemon, oldest first.
+func (c *Client) Logs(ctx context.Context, req LogsRequest) ([]LogEntry, error) {
+	query := url.Values{}
+	if req.Device != "" {
+		query.Set("device", req.Device)
+	}
+	if !req.Since.IsZero() {
+		query.Set("since", req.Since.Format(time.RFC3339Nano))
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+	path := "/logs"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var resp LogsResponse
+	if err := c.get(ctx, path, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Lines, nil
+}
+
+// LogStreamRequest selects the lines returned by StreamLogs.
+type LogStreamRequest struct {
+	// Device restricts the stream to one bridge (empty for all of them).
+	Device string
+	// Filter keeps only lines containing this substring.
+	Filter string
+	// Backlog is how many recent lines per bridge to replay first.
+	Backlog int
+}
+
+// StreamLogs follows device logs, calling fn for each line until ctx is
+// canceled, the daemon closes the stream or fn returns an error.
+func (c *Client) StreamLogs(ctx context.Context, req LogStreamRequest, fn func(LogEntry) error) error {
+	query := url.Values{}
+	if req.Device != "" {
+		query.Set("device", req.Device)
+	}
+	if req.Filter != "" {
+		query.Set("filter", req.Filter)
+	}
+	if req.Backlog > 0 {
+		query.Set("backlog", strconv.Itoa(req.Backlog))
+	}
+	path := "/logs/stream"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	httpReq, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("build log stream request: %w", err)
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("send log stream request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("log stream request failed: %w", responseError(resp))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			// Blank separators and keep-alive comments.
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return fmt.Errorf("decode log entry: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("read log stream: %w", err)
+	}
+	return ctx.Err()
+}
@@ -3,39 +3,110 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
+
+	"github.com/2opremio/keybridged/hid"
 )
 
 const defaultHost = "localhost:9876"
 
 type Client struct {
-	baseURL string
-	http    *http.Client
+	baseURL      string
+	http         *http.Client
+	token        string
+	retry        RetryPolicy
+	waitForReady bool
 }
 
 type Config struct {
 	Host       string
 	HTTPClient *http.Client
+	// Token is sent as a bearer token, for daemons started with -token-file
+	// or KEYBRIDGED_TOKENS.
+	Token string
+	// TLS, if set, connects over HTTPS (and WSS for streams) with this
+	// configuration, including a client certificate for daemons started
+	// with -tls-client-ca. It applies only if HTTPClient is nil; otherwise
+	// HTTPClient must be set up for TLS, and TLS only switches the scheme.
+	TLS *tls.Config
+	// UnixSocket, if set, connects to the daemon's -unix-socket at this
+	// path instead of Host. Like TLS, it applies only if HTTPClient is nil.
+	UnixSocket string
+	// Retry retries key events that fail because the bridge is
+	// disconnected or busy, e.g. while the daemon reconnects to it. By
+	// default, only failures before anything was sent are retried.
+	Retry RetryPolicy
+	// WaitForReady makes key events wait, before each attempt, until the
+	// daemon reports their bridge as connected (see WaitReady) or the
+	// context expires.
+	WaitForReady bool
 }
 
 func New(config Config) *Client {
 	httpClient := config.HTTPClient
 	if httpClient == nil {
 		httpClient = &http.Client{}
+		if config.TLS != nil || config.UnixSocket != "" {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = config.TLS
+			if socket := config.UnixSocket; socket != "" {
+				transport.Proxy = nil
+				transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				}
+			}
+			httpClient.Transport = transport
+		}
 	}
 	host := strings.TrimSpace(config.Host)
+	if config.UnixSocket != "" {
+		// The host only fills in the Host header; every connection goes
+		// to the socket.
+		host = "localhost"
+	}
 	if host == "" {
 		host = defaultHost
 	}
-	baseURL := "http://" + strings.TrimRight(host, "/")
+	scheme := "http://"
+	if config.TLS != nil {
+		scheme = "https://"
+	}
+	baseURL := scheme + strings.TrimRight(host, "/")
 	return &Client{
-		baseURL: baseURL,
-		http:    httpClient,
+		baseURL:      baseURL,
+		http:         httpClient,
+		token:        strings.TrimSpace(config.Token),
+		retry:        config.Retry,
+		waitForReady: config.WaitForReady,
+	}
+}
+
+// header returns the headers sent with every request.
+func (c *Client) header() http.Header {
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
 	}
+	return header
+}
+
+// newRequest builds a request to the daemon.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.header() {
+		req.Header[key] = values
+	}
+	return req, nil
 }
 
 // PressAndReleaseModifiers matches the `modifiers` object in the HTTP API.
@@ -57,6 +128,10 @@ type PressAndReleaseModifiers struct {
 // See the shared serial protocol docs (also includes code references and examples):
 // https://github.com/2opremio/PicoUSBKeyBridge#serial-protocol
 type PressAndReleaseRequest struct {
+	// Device names the bridge to send the event to. It may be omitted when
+	// the daemon drives a single bridge.
+	Device string `json:"device,omitempty"`
+
 	// Type selects the HID usage page used by Code.
 	// Supported values:
 	//   - "keyboard": USB HID Keyboard/Keypad usage page
@@ -73,26 +148,174 @@ type PressAndReleaseRequest struct {
 	// For Type "consumer", Code is a 16-bit Consumer Page (0x0C) usage (e.g. 0x00CD Play/Pause).
 	Code      uint16                    `json:"code"`
 	Modifiers *PressAndReleaseModifiers `json:"modifiers,omitempty"`
+
+	// HoldMS is how long the daemon waits between the press and the release,
+	// in milliseconds (at most 60000). Zero releases immediately.
+	HoldMS uint32 `json:"hold_ms,omitempty"`
+}
+
+// KeyRequest matches the `POST /press` and `POST /release` request bodies.
+// Fields have the same meaning as in PressAndReleaseRequest.
+type KeyRequest struct {
+	Device    string                    `json:"device,omitempty"`
+	Type      string                    `json:"type,omitempty"`
+	Code      uint16                    `json:"code"`
+	Modifiers *PressAndReleaseModifiers `json:"modifiers,omitempty"`
 }
 
 func (c *Client) SendPressAndRelease(ctx context.Context, req PressAndReleaseRequest) error {
+	return c.send(ctx, "/pressandrelease", req.Device, req)
+}
+
+// SendPress presses a key without releasing it. Pair it with SendRelease
+// (or ReleaseAll) to hold keys across requests.
+func (c *Client) SendPress(ctx context.Context, req KeyRequest) error {
+	return c.send(ctx, "/press", req.Device, req)
+}
+
+// SendRelease releases a key pressed with SendPress.
+func (c *Client) SendRelease(ctx context.Context, req KeyRequest) error {
+	return c.send(ctx, "/release", req.Device, req)
+}
+
+// TypeRequest matches the `POST /type` request body.
+type TypeRequest struct {
+	Device string `json:"device,omitempty"`
+	// Text is typed character by character. Newlines and tabs are sent as
+	// Enter and Tab.
+	Text string `json:"text"`
+	// Layout is the keyboard layout configured on the target host (see
+	// hid.LayoutNames). If empty, the daemon uses "us".
+	Layout string `json:"layout,omitempty"`
+}
+
+// Type types text on the target host using the given layout.
+func (c *Client) Type(ctx context.Context, req TypeRequest) error {
+	return c.post(ctx, "/type", req)
+}
+
+// KeysRequest matches the `POST /keys` request body.
+type KeysRequest struct {
+	Device string `json:"device,omitempty"`
+	// Keys is a shortcut such as "cmd+shift+4" or "media:playpause"; see
+	// hid.ParseChord for the syntax.
+	Keys   string `json:"keys"`
+	HoldMS uint32 `json:"hold_ms,omitempty"`
+}
+
+// SendKeys presses and releases a shortcut parsed by the daemon.
+func (c *Client) SendKeys(ctx context.Context, req KeysRequest) error {
+	return c.send(ctx, "/keys", req.Device, req)
+}
+
+// ParseKeys turns a shortcut such as "cmd+shift+4", "fn+f11" or
+// "media:playpause" into a PressAndReleaseRequest.
+func ParseKeys(keys string) (PressAndReleaseRequest, error) {
+	chord, err := hid.ParseChord(keys)
+	if err != nil {
+		return PressAndReleaseRequest{}, err
+	}
+	if chord.Consumer {
+		return PressAndReleaseRequest{Type: "consumer", Code: chord.Code}, nil
+	}
+	return PressAndReleaseRequest{Type: "keyboard", Code: chord.Code, Modifiers: NewModifiers(chord.Modifiers, chord.AppleFn)}, nil
+}
+
+// NewModifiers converts a HID modifier byte (hid.ModLeftCtrl...) and the
+// Apple Fn flag, e.g. from a hid.Keystroke, into request modifiers. It
+// returns nil if none are set.
+func NewModifiers(mask byte, appleFn bool) *PressAndReleaseModifiers {
+	if mask == 0 && !appleFn {
+		return nil
+	}
+	return &PressAndReleaseModifiers{
+		LeftCtrl:   mask&hid.ModLeftCtrl != 0,
+		LeftShift:  mask&hid.ModLeftShift != 0,
+		LeftAlt:    mask&hid.ModLeftAlt != 0,
+		LeftGUI:    mask&hid.ModLeftGUI != 0,
+		RightCtrl:  mask&hid.ModRightCtrl != 0,
+		RightShift: mask&hid.ModRightShift != 0,
+		RightAlt:   mask&hid.ModRightAlt != 0,
+		RightGUI:   mask&hid.ModRightGUI != 0,
+		AppleFn:    appleFn,
+	}
+}
+
+// post sends req as a JSON body and checks for a 200 response. Error
+// responses are returned as a wrapped *Error.
+func (c *Client) post(ctx context.Context, path string, req any) error {
+	name := strings.TrimPrefix(path, "/")
 	payload, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("marshal pressandrelease: %w", err)
+		return fmt.Errorf("marshal %s: %w", name, err)
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/pressandrelease", bytes.NewReader(payload))
+	httpReq, err := c.newRequest(ctx, http.MethodPost, path, bytes.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("build pressandrelease request: %w", err)
+		return fmt.Errorf("build %s request: %w", name, err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 	resp, err := c.http.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("send pressandrelease request: %w", err)
+		return fmt.Errorf("send %s request: %w", name, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return fmt.Errorf("pressandrelease request failed: %s (%s)", resp.Status, string(body))
+		return fmt.Errorf("%s request failed: %w", name, responseError(resp))
+	}
+	return nil
+}
+
+// get fetches path and decodes the JSON response into resp.
+func (c *Client) get(ctx context.Context, path string, resp any) error {
+	name, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "?")
+	httpReq, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", name, err)
+	}
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("send %s request: %w", name, err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s request failed: %w", name, responseError(httpResp))
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return fmt.Errorf("decode %s response: %w", name, err)
 	}
 	return nil
 }
+
+// ReleaseAllRequest matches the `POST /releaseall` request body.
+type ReleaseAllRequest struct {
+	// Device names the bridge whose keys are released. If empty, keys are
+	// released on every bridge.
+	Device string `json:"device,omitempty"`
+}
+
+// ReleaseAll releases every key and consumer control currently held by the
+// bridge named in req (or by all bridges).
+func (c *Client) ReleaseAll(ctx context.Context, req ReleaseAllRequest) error {
+	return c.send(ctx, "/releaseall", req.Device, req)
+}
+
+// DeviceInfo describes a bridge in the `GET /devices` response.
+type DeviceInfo struct {
+	Name      string `json:"name"`
+	Selector  string `json:"selector"`
+	Connected bool   `json:"connected"`
+	Port      string `json:"port,omitempty"`
+}
+
+// DevicesResponse matches the `GET /devices` response body.
+type DevicesResponse struct {
+	Devices []DeviceInfo `json:"devices"`
+}
+
+func (c *Client) Devices(ctx context.Context) ([]DeviceInfo, error) {
+	var resp DevicesResponse
+	if err := c.get(ctx, "/devices", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Devices, nil
+}
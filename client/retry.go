@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 2 * time.Second
+	readyPollInterval     = 250 * time.Millisecond
+)
+
+// RetryPolicy controls how key events are retried. The zero value makes a
+// single attempt.
+//
+// Only SendPressAndRelease, SendPress, SendRelease, SendKeys and ReleaseAll
+// are retried. Type and SendSequence aren't, since a failure may come after
+// part of the text or sequence has been sent.
+//
+// By default, only errors that guarantee nothing reached the bridge are
+// retried (see IsNotSent). Retrying other errors, e.g. with IsRetryable, can
+// duplicate keystrokes: a device_disconnected or queue_timeout error may
+// come after the press was written, and the retry presses the key again.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled for each
+	// further retry up to MaxBackoff. They default to 100ms and 2s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Retryable reports whether a failed attempt should be retried.
+	// Defaults to IsNotSent: the bridge was busy or disconnected before
+	// anything was sent, or the daemon couldn't be reached.
+	Retryable func(error) bool
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsNotSent(err)
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	backoff, maxBackoff := p.InitialBackoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = defaultInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	for range retry {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
+
+// send posts a key event for device, waiting for it to be ready and
+// retrying as configured.
+func (c *Client) send(ctx context.Context, path, device string, req any) error {
+	for attempt := 1; ; attempt++ {
+		if c.waitForReady {
+			if err := c.WaitReady(ctx, device); err != nil {
+				return err
+			}
+		}
+		err := c.post(ctx, path, req)
+		if err == nil || attempt >= c.retry.MaxAttempts || !c.retry.retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(c.retry.backoff(attempt - 1))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// WaitReady polls `GET /readyz` until the named bridge (or every bridge, if
+// device is empty) is connected, or ctx expires. Unknown devices and
+// authentication failures are returned right away; other errors, e.g. while
+// the daemon restarts, are retried.
+func (c *Client) WaitReady(ctx context.Context, device string) error {
+	path := "/readyz"
+	if device = strings.TrimSpace(device); device != "" {
+		path += "?device=" + url.QueryEscape(device)
+	}
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	for {
+		ready, err := c.ready(ctx, path)
+		if ready {
+			return nil
+		}
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+			return fmt.Errorf("readyz request failed: %w", apiErr)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("wait for ready: %w (%v)", ctx.Err(), err)
+		}
+	}
+}
+
+// ready reports whether GET path returned 200. Otherwise the error says
+// why not.
+func (c *Client) ready(ctx context.Context, path string) (bool, error) {
+	httpReq, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return true, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return false, fmt.Errorf("read %s response: %w", path, err)
+	}
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		var decoded ReadyResponse
+		if json.Unmarshal(body, &decoded) == nil && len(decoded.Disconnected) > 0 {
+			return false, fmt.Errorf("disconnected: %s", strings.Join(decoded.Disconnected, ", "))
+		}
+	}
+	// Not a readiness report, e.g. an error response: let responseError
+	// decode the same bytes.
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return false, responseError(resp)
+}
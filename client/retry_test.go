@@ -0,0 +1,115 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer answers every request with a device_disconnected error,
+// flagged as not sent if notSent is set, until it has failed failures times.
+func failingServer(t *testing.T, failures int32, notSent bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) > failures {
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorDetail{
+			Code:    CodeDeviceDisconnected,
+			Message: "send failed: keybridge not connected",
+			NotSent: notSent,
+		}})
+	}))
+	t.Cleanup(server.Close)
+	return server, &attempts
+}
+
+func testRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+}
+
+func TestRetryNotSent(t *testing.T) {
+	server, attempts := failingServer(t, 2, true)
+	kb := New(Config{Host: strings.TrimPrefix(server.URL, "http://"), Retry: testRetryPolicy()})
+	if err := kb.SendKeys(t.Context(), KeysRequest{Keys: "cmd+space"}); err != nil {
+		t.Fatalf("SendKeys: %v", err)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+// An error not flagged as not sent may come after the press was written,
+// so retrying it by default could repeat the keystroke.
+func TestNoRetryAfterPossibleSend(t *testing.T) {
+	server, attempts := failingServer(t, 2, false)
+	kb := New(Config{Host: strings.TrimPrefix(server.URL, "http://"), Retry: testRetryPolicy()})
+	err := kb.SendKeys(t.Context(), KeysRequest{Keys: "cmd+space"})
+	if !IsRetryable(err) || IsNotSent(err) {
+		t.Fatalf("SendKeys = %v, want a retryable error that may have been sent", err)
+	}
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+
+	policy := testRetryPolicy()
+	policy.Retryable = IsRetryable
+	kb = New(Config{Host: strings.TrimPrefix(server.URL, "http://"), Retry: policy})
+	if err := kb.SendKeys(t.Context(), KeysRequest{Keys: "cmd+space"}); err != nil {
+		t.Fatalf("SendKeys with IsRetryable: %v", err)
+	}
+}
+
+func TestDialErrorIsNotSent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	kb := New(Config{Host: addr})
+	if err := kb.SendKeys(t.Context(), KeysRequest{Keys: "a"}); !IsNotSent(err) {
+		t.Errorf("SendKeys to a closed port = %v, want a not sent error", err)
+	}
+}
+
+func TestReadyErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   any
+		want   string
+		code   ErrorCode
+	}{
+		{"disconnected", http.StatusServiceUnavailable, ReadyResponse{Status: "unavailable", Disconnected: []string{"ipad"}}, "disconnected: ipad", ""},
+		{"error response", http.StatusServiceUnavailable, ErrorResponse{Error: ErrorDetail{Code: CodeDeviceClosed, Message: "shutting down"}}, "shutting down", CodeDeviceClosed},
+		{"unknown device", http.StatusNotFound, ErrorResponse{Error: ErrorDetail{Code: CodeUnknownDevice, Message: "unknown device: tv"}}, "unknown device: tv", CodeUnknownDevice},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			_ = json.NewEncoder(w).Encode(test.body)
+		}))
+		kb := New(Config{Host: strings.TrimPrefix(server.URL, "http://")})
+		ready, err := kb.ready(t.Context(), "/readyz")
+		server.Close()
+		if ready || err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: ready = %v, %v, want an error containing %q", test.name, ready, err, test.want)
+			continue
+		}
+		var apiErr *Error
+		if test.code != "" && (!errors.As(err, &apiErr) || apiErr.Code != test.code || apiErr.StatusCode != test.status) {
+			t.Errorf("%s: error = %#v, want code %s and status %d", test.name, err, test.code, test.status)
+		}
+	}
+}
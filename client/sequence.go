@@ -0,0 +1,114 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Sequence step actions.
+const (
+	ActionPress           = "press"
+	ActionRelease         = "release"
+	ActionPressAndRelease = "pressandrelease"
+	ActionConsumer        = "consumer"
+	ActionType            = "type"
+	ActionDelay           = "delay"
+)
+
+// SequenceStep is one step of a `POST /sequence` request.
+//
+// Which fields apply depends on Action:
+//   - "press", "release", "pressandrelease": Type/Code/Modifiers as in
+//     PressAndReleaseRequest, or Keys as in KeysRequest. HoldMS applies to
+//     "pressandrelease".
+//   - "consumer": Code is a Consumer Page usage, pressed and released
+//     (HoldMS applies).
+//   - "type": Text and Layout as in TypeRequest.
+//   - "delay": waits DelayMS milliseconds.
+type SequenceStep struct {
+	Action    string                    `json:"action"`
+	Type      string                    `json:"type,omitempty"`
+	Code      uint16                    `json:"code,omitempty"`
+	Modifiers *PressAndReleaseModifiers `json:"modifiers,omitempty"`
+	Keys      string                    `json:"keys,omitempty"`
+	HoldMS    uint32                    `json:"hold_ms,omitempty"`
+	Text      string                    `json:"text,omitempty"`
+	Layout    string                    `json:"layout,omitempty"`
+	DelayMS   uint32                    `json:"delay_ms,omitempty"`
+}
+
+// SequenceRequest matches the `POST /sequence` request body. Steps run in
+// order with exclusive access to the bridge.
+type SequenceRequest struct {
+	Device string         `json:"device,omitempty"`
+	Steps  []SequenceStep `json:"steps"`
+}
+
+// Sequence step statuses.
+const (
+	StepOK      = "ok"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+)
+
+// SequenceStepResult reports the outcome of one step.
+type SequenceStepResult struct {
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Code classifies Error, as in error responses.
+	Code ErrorCode `json:"code,omitempty"`
+}
+
+// SequenceResponse matches the `POST /sequence` response body. Status is
+// "ok" if every step succeeded, "failed" otherwise.
+type SequenceResponse struct {
+	Status string               `json:"status"`
+	Steps  []SequenceStepResult `json:"steps"`
+}
+
+// SendSequence runs a sequence of steps. If a step fails, the daemon stops,
+// releases every held key and returns the per-step results along with an
+// error.
+func (c *Client) SendSequence(ctx context.Context, req SequenceRequest) (SequenceResponse, error) {
+	var decoded SequenceResponse
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return decoded, fmt.Errorf("marshal sequence: %w", err)
+	}
+	httpReq, err := c.newRequest(ctx, http.MethodPost, "/sequence", bytes.NewReader(payload))
+	if err != nil {
+		return decoded, fmt.Errorf("build sequence request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return decoded, fmt.Errorf("send sequence request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return decoded, fmt.Errorf("read sequence response: %w", err)
+	}
+	if json.Unmarshal(body, &decoded) != nil || decoded.Status == "" {
+		if resp.StatusCode != http.StatusOK {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return decoded, fmt.Errorf("sequence request failed: %w", responseError(resp))
+		}
+		return decoded, fmt.Errorf("decode sequence response: invalid JSON")
+	}
+	if decoded.Status != StepOK {
+		for i, step := range decoded.Steps {
+			if step.Status == StepFailed {
+				stepErr := &Error{StatusCode: resp.StatusCode, Code: step.Code, Message: step.Error}
+				return decoded, fmt.Errorf("sequence failed at step %d (%s): %w", i, step.Action, stepErr)
+			}
+		}
+		return decoded, fmt.Errorf("sequence request failed: %s", resp.Status)
+	}
+	return decoded, nil
+}
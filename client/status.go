@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// DeviceStatus describes a bridge in the `GET /status` response.
+type DeviceStatus struct {
+	Name      string `json:"name"`
+	Selector  string `json:"selector"`
+	Connected bool   `json:"connected"`
+	Port      string `json:"port,omitempty"`
+	// VID and PID of the connected USB serial adapter, as "0x1915".
+	VID string `json:"vid,omitempty"`
+	PID string `json:"pid,omitempty"`
+	// ConnectedAt and ConnectedSeconds are set while connected.
+	ConnectedAt      *time.Time `json:"connected_at,omitempty"`
+	ConnectedSeconds float64    `json:"connected_seconds,omitempty"`
+	Reconnects       int        `json:"reconnects"`
+	// LastError is the most recent connect or I/O error, kept after the
+	// bridge reconnects.
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	// QueueDepth is the number of packets waiting to be written, including
+	// those of senders still waiting for room in the write queue.
+	QueueDepth int `json:"queue_depth"`
+	// Serial is the serial port configuration of the bridge.
+	Serial SerialMode `json:"serial"`
+}
+
+// SerialMode describes how the daemon opens a bridge's serial port.
+type SerialMode struct {
+	BaudRate int `json:"baud_rate"`
+	DataBits int `json:"data_bits"`
+	// Parity is "none", "odd", "even", "mark" or "space".
+	Parity string `json:"parity"`
+	// StopBits is 1, 1.5 or 2.
+	StopBits float64 `json:"stop_bits"`
+	// DTR and RTS report whether the control lines are asserted once the
+	// port is open.
+	DTR bool `json:"dtr"`
+	RTS bool `json:"rts"`
+	// PulseMS is how long DTR and RTS are held inverted after opening the
+	// port, zero if disabled.
+	PulseMS int64 `json:"pulse_ms,omitempty"`
+}
+
+// StatusResponse matches the `GET /status` response body.
+type StatusResponse struct {
+	Devices []DeviceStatus `json:"devices"`
+}
+
+// Status returns the connection state of every bridge.
+func (c *Client) Status(ctx context.Context) ([]DeviceStatus, error) {
+	var resp StatusResponse
+	if err := c.get(ctx, "/status", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Devices, nil
+}
+
+// ReadyResponse matches the `GET /readyz` response body.
+type ReadyResponse struct {
+	Status string `json:"status"`
+	// Disconnected lists the bridges that aren't connected.
+	Disconnected []string `json:"disconnected,omitempty"`
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// ErrStreamClosed is returned for frames sent on, or pending when closing, a Stream.
+var ErrStreamClosed = errors.New("stream closed")
+
+// StreamFrame is a message sent over the `/ws` WebSocket. The embedded
+// step accepts the same actions as SequenceStep; ID is echoed in the ack.
+type StreamFrame struct {
+	ID uint64 `json:"id"`
+	SequenceStep
+}
+
+// StreamAck acknowledges a StreamFrame once it has been written to the
+// bridge (Status "ok") or failed (Status "failed").
+type StreamAck struct {
+	ID     uint64 `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Code classifies Error, as in error responses.
+	Code ErrorCode `json:"code,omitempty"`
+}
+
+// Stream is a WebSocket session for sending key events with one round trip
+// per event and well-defined ordering. The daemon executes frames in the
+// order they are sent.
+type Stream struct {
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan error
+	err     error
+	done    chan struct{}
+}
+
+// OpenStream opens a streaming session to the named bridge (empty if the
+// daemon drives a single bridge).
+func (c *Client) OpenStream(ctx context.Context, device string) (*Stream, error) {
+	wsURL := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/ws"
+	if device != "" {
+		wsURL += "?device=" + url.QueryEscape(device)
+	}
+	conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{HTTPClient: c.http, HTTPHeader: c.header()})
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	s := &Stream{
+		conn:    conn,
+		pending: make(map[uint64]chan error),
+		done:    make(chan struct{}),
+	}
+	go s.readLoop()
+	return s, nil
+}
+
+// Go sends a frame without waiting for its ack. The returned channel
+// receives the outcome. Frames are executed in the order Go is called.
+func (s *Stream) Go(ctx context.Context, step SequenceStep) <-chan error {
+	result := make(chan error, 1)
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	if s.err != nil {
+		err := s.err
+		s.mu.Unlock()
+		result <- err
+		return result
+	}
+	s.nextID++
+	id := s.nextID
+	s.pending[id] = result
+	s.mu.Unlock()
+
+	payload, err := json.Marshal(StreamFrame{ID: id, SequenceStep: step})
+	if err == nil {
+		err = s.conn.Write(ctx, websocket.MessageText, payload)
+	}
+	if err != nil {
+		// The read loop may already have failed the frame, filling result.
+		s.mu.Lock()
+		_, ok := s.pending[id]
+		delete(s.pending, id)
+		s.mu.Unlock()
+		if ok {
+			result <- fmt.Errorf("send stream frame: %w", err)
+		}
+	}
+	return result
+}
+
+// Send sends a frame and waits for the daemon to acknowledge it.
+func (s *Stream) Send(ctx context.Context, step SequenceStep) error {
+	select {
+	case err := <-s.Go(ctx, step):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Press presses a key without releasing it.
+func (s *Stream) Press(ctx context.Context, req KeyRequest) error {
+	return s.Send(ctx, SequenceStep{Action: ActionPress, Type: req.Type, Code: req.Code, Modifiers: req.Modifiers})
+}
+
+// Release releases a key pressed with Press.
+func (s *Stream) Release(ctx context.Context, req KeyRequest) error {
+	return s.Send(ctx, SequenceStep{Action: ActionRelease, Type: req.Type, Code: req.Code, Modifiers: req.Modifiers})
+}
+
+// Consumer presses and releases a Consumer Page usage.
+func (s *Stream) Consumer(ctx context.Context, usage uint16) error {
+	return s.Send(ctx, SequenceStep{Action: ActionConsumer, Code: usage})
+}
+
+// Close ends the session. Keys still held by it are released by the daemon.
+func (s *Stream) Close() error {
+	err := s.conn.Close(websocket.StatusNormalClosure, "")
+	<-s.done
+	return err
+}
+
+func (s *Stream) readLoop() {
+	defer close(s.done)
+	ctx := context.Background()
+	for {
+		_, data, err := s.conn.Read(ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
+				err = ErrStreamClosed
+			}
+			s.fail(err)
+			return
+		}
+		var ack StreamAck
+		if err := json.Unmarshal(data, &ack); err != nil {
+			continue
+		}
+		s.mu.Lock()
+		result, ok := s.pending[ack.ID]
+		delete(s.pending, ack.ID)
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if ack.Status != StepOK {
+			result <- fmt.Errorf("stream frame %d failed: %w", ack.ID, &Error{Code: ack.Code, Message: ack.Error})
+			continue
+		}
+		result <- nil
+	}
+}
+
+func (s *Stream) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	for id, result := range s.pending {
+		result <- s.err
+		delete(s.pending, id)
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// A write failing after the read loop has already failed the frame must
+// not block on the full result channel.
+func TestStreamServerClosesDuringWrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.SetReadLimit(-1)
+		// Take the first frame, then drop the connection while the client
+		// is writing the next one.
+		_, _, _ = conn.Read(r.Context())
+		_ = conn.CloseNow()
+	}))
+	defer server.Close()
+	kb := New(Config{Host: strings.TrimPrefix(server.URL, "http://")})
+	text := strings.Repeat("a", 16<<20)
+
+	for i := 0; i < 2; i++ {
+		stream, err := kb.OpenStream(t.Context(), "")
+		if err != nil {
+			t.Fatalf("OpenStream: %v", err)
+		}
+		results := make(chan (<-chan error), 3)
+		go func() {
+			for j := 0; j < cap(results); j++ {
+				results <- stream.Go(t.Context(), SequenceStep{Action: ActionType, Text: text})
+			}
+		}()
+		for j := 0; j < cap(results); j++ {
+			select {
+			case result := <-results:
+				select {
+				case err := <-result:
+					if err == nil {
+						t.Errorf("frame %d succeeded after the server closed", j)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("frame %d got no result", j)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Go blocked on frame %d", j)
+			}
+		}
+		_ = stream.Close()
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/2opremio/keybridged/hid"
+)
+
+// completeCommand is the hidden subcommand the completion scripts call with
+// the words typed so far, the last one being completed. It prints one
+// candidate per line.
+const completeCommand = "__complete"
+
+// globalValueFlags are the global flags that take a separate value.
+var globalValueFlags = map[string]bool{
+	"host": true, "unix-socket": true, "token": true, "device": true, "timeout": true,
+	"retries": true, "tls-ca": true, "tls-cert": true, "tls-key": true,
+}
+
+func complete(w io.Writer, words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current, previous := words[len(words)-1], words[:len(words)-1]
+	var subcommand string
+	for i := 0; i < len(previous); i++ {
+		word := previous[i]
+		if !strings.HasPrefix(word, "-") {
+			subcommand = word
+			break
+		}
+		if name := strings.TrimLeft(word, "-"); globalValueFlags[name] {
+			i++
+		}
+	}
+	var candidates []string
+	switch {
+	case subcommand == "":
+		for _, cmd := range commands {
+			candidates = append(candidates, cmd.name)
+		}
+	case len(previous) > 0 && strings.TrimLeft(previous[len(previous)-1], "-") == "layout":
+		candidates = hid.LayoutNames()
+	case subcommand == "key" || subcommand == "press" || subcommand == "release":
+		candidates = completeChord(current)
+	case subcommand == "consumer":
+		candidates = hid.ConsumerNames()
+	case subcommand == "completion":
+		candidates = []string{"bash", "zsh", "fish"}
+	}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			fmt.Fprintln(w, candidate)
+		}
+	}
+}
+
+// completeChord completes the last "+"-separated part of a shortcut.
+func completeChord(current string) []string {
+	prefix := current[:strings.LastIndex(current, "+")+1]
+	names := append(hid.ModifierNames(), hid.KeyNames()...)
+	candidates := make([]string, 0, len(names))
+	for _, name := range names {
+		candidates = append(candidates, prefix+name)
+	}
+	return candidates
+}
+
+func runCompletion(_ context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return errUsage
+	}
+	_, err := io.WriteString(c.stdout, script)
+	return err
+}
+
+var completionScripts = map[string]string{
+	// COMP_WORDBREAKS splits on ":" and "=", so words are taken from the
+	// command line up to the cursor instead of COMP_WORDS.
+	"bash": `# kbctl completion for bash. Load with: source <(kbctl completion bash)
+_kbctl() {
+	local line=${COMP_LINE:0:COMP_POINT} cur=${COMP_WORDS[COMP_CWORD]}
+	local -a words
+	read -r -a words <<< "$line"
+	[[ $line == *" " ]] && words+=("")
+	local IFS=$'\n'
+	COMPREPLY=($(kbctl __complete "${words[@]:1}" 2>/dev/null))
+	# Candidates are whole words; keep only the part after the last break.
+	local typed=${words[${#words[@]}-1]}
+	local head=${typed%"$cur"}
+	COMPREPLY=("${COMPREPLY[@]#"$head"}")
+}
+complete -o default -F _kbctl kbctl
+`,
+	"zsh": `#compdef kbctl
+# kbctl completion for zsh. Load with: source <(kbctl completion zsh)
+_kbctl() {
+	local -a candidates
+	candidates=("${(@f)$(kbctl __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if (( ${#candidates} )) && [[ -n $candidates[1] ]]; then
+		compadd -Q -- $candidates
+	else
+		_files
+	fi
+}
+compdef _kbctl kbctl
+`,
+	"fish": `# kbctl completion for fish. Load with: kbctl completion fish | source
+complete -c kbctl -f -a '(kbctl __complete (commandline -opc)[2..-1] (commandline -ct))'
+`,
+}
@@ -0,0 +1,427 @@
+// Command kbctl sends key events to keybridged from the command line:
+//
+//	kbctl key cmd+shift+4
+//	kbctl type "Hello world!" --layout us
+//	kbctl consumer playpause
+//	kbctl run < script.kb
+//
+// Run "kbctl help" for every subcommand and flag.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/hid"
+)
+
+const (
+	hostEnv  = "KEYBRIDGE_HOST"
+	tokenEnv = "KEYBRIDGE_TOKEN"
+)
+
+// maxSequenceSteps matches the daemon's limit on /sequence steps.
+const maxSequenceSteps = 256
+
+// errUsage reports invalid arguments; main prints the usage for it.
+var errUsage = errors.New("usage")
+
+// command is a kbctl subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = []command{
+	{"key", "<keys> [--hold <duration>]", "press and release a shortcut such as cmd+shift+4", runKey},
+	{"press", "<keys>", "press a shortcut without releasing it", runPress},
+	{"release", "<keys>", "release a shortcut pressed with press", runRelease},
+	{"releaseall", "", "release every held key", runReleaseAll},
+	{"type", "<text> [--layout <layout>]", "type text, mapped to keystrokes for the target host's layout", runType},
+	{"consumer", "<control> [--hold <duration>]", "press and release a media control such as playpause", runConsumer},
+	{"run", "[file] [--layout <layout>]", "run a key script from file, or from stdin", runScript},
+	{"status", "", "show the bridges' connection state", runStatus},
+	{"keys", "[--consumer]", "list key (or media control) names and their HID usages", runKeys},
+	{"completion", "bash|zsh|fish", "print a shell completion script", runCompletion},
+}
+
+// cli holds the global flags.
+type cli struct {
+	host       string
+	unixSocket string
+	token      string
+	device     string
+	timeout    time.Duration
+	retries    int
+	wait       bool
+	tlsCA      string
+	tlsCert    string
+	tlsKey     string
+	stdin      io.Reader
+	stdout     io.Writer
+}
+
+func main() {
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout}
+	flags := flag.NewFlagSet("kbctl", flag.ContinueOnError)
+	flags.StringVar(&c.host, "host", envOr(hostEnv, "localhost:9876"), "keybridged host:port, or an http:// or https:// URL (also "+hostEnv+")")
+	flags.StringVar(&c.unixSocket, "unix-socket", "", "Path of keybridged's -unix-socket, instead of -host")
+	flags.StringVar(&c.token, "token", os.Getenv(tokenEnv), "Bearer token for daemons started with -token-file (also "+tokenEnv+")")
+	flags.StringVar(&c.device, "device", "", "Name of the bridge to send to (required when the daemon drives several)")
+	flags.DurationVar(&c.timeout, "timeout", 30*time.Second, "Timeout for the whole command")
+	flags.IntVar(&c.retries, "retries", 2, "Times to retry an event while the bridge is disconnected or busy")
+	flags.BoolVar(&c.wait, "wait", false, "Wait until the bridge is connected before sending (up to -timeout)")
+	flags.StringVar(&c.tlsCA, "tls-ca", "", "PEM CA bundle to verify an HTTPS daemon with (default: system roots)")
+	flags.StringVar(&c.tlsCert, "tls-cert", "", "PEM client certificate, for daemons started with -tls-client-ca")
+	flags.StringVar(&c.tlsKey, "tls-key", "", "PEM private key for -tls-cert")
+	flags.Usage = func() { usage(flags) }
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	args := flags.Args()
+	if len(args) == 0 || args[0] == "help" {
+		usage(flags)
+		if len(args) == 0 {
+			os.Exit(2)
+		}
+		return
+	}
+	if args[0] == completeCommand {
+		complete(c.stdout, args[1:])
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(ctx, c, args[1:])
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: kbctl [flags] %s %s\n", cmd.name, cmd.args)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "kbctl: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "kbctl: unknown command %q\n", args[0])
+	usage(flags)
+	os.Exit(2)
+}
+
+func usage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintln(out, "usage: kbctl [flags] <command> [args]")
+	fmt.Fprintln(out, "\ncommands:")
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	_ = w.Flush()
+	fmt.Fprintln(out, "\nflags:")
+	flags.PrintDefaults()
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// client builds the API client from the global flags.
+func (c *cli) client() (*client.Client, error) {
+	config := client.Config{
+		Host:         c.host,
+		UnixSocket:   c.unixSocket,
+		Token:        c.token,
+		Retry:        client.RetryPolicy{MaxAttempts: c.retries + 1},
+		WaitForReady: c.wait,
+	}
+	host, secure := strings.CutPrefix(config.Host, "https://")
+	if !secure {
+		host = strings.TrimPrefix(host, "http://")
+	}
+	config.Host = strings.TrimRight(host, "/")
+	if secure || c.tlsCA != "" || c.tlsCert != "" {
+		tlsConfig, err := c.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.TLS = tlsConfig
+	}
+	return client.New(config), nil
+}
+
+func (c *cli) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.tlsCA != "" {
+		pem, err := os.ReadFile(c.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("read -tls-ca: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("-tls-ca %s: no certificates found", c.tlsCA)
+		}
+	}
+	if c.tlsCert != "" || c.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.tlsCert, c.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("load -tls-cert/-tls-key: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// parseArgs parses flags that may follow positional arguments, as in
+// `kbctl type "Hello" --layout de`, and returns the positional arguments.
+// Arguments after "--" are never flags.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	var rest []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, rest = args[:i], args[i+1:]
+	}
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %w", errUsage, err)
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// holdMS converts a --hold duration into the API's hold_ms.
+func holdMS(hold time.Duration) (uint32, error) {
+	if hold < 0 || hold > time.Minute {
+		return 0, fmt.Errorf("--hold must be between 0 and 1m")
+	}
+	return uint32(hold.Milliseconds()), nil
+}
+
+func runKey(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("key", flag.ContinueOnError)
+	hold := flags.Duration("hold", 0, "")
+	args, err := parseArgs(flags, args)
+	if err != nil || len(args) != 1 {
+		return errUsage
+	}
+	req, err := client.ParseKeys(args[0])
+	if err != nil {
+		return err
+	}
+	if req.HoldMS, err = holdMS(*hold); err != nil {
+		return err
+	}
+	req.Device = c.device
+	kb, err := c.client()
+	if err != nil {
+		return err
+	}
+	return kb.SendPressAndRelease(ctx, req)
+}
+
+func runPress(ctx context.Context, c *cli, args []string) error {
+	return sendKey(ctx, c, args, (*client.Client).SendPress)
+}
+
+func runRelease(ctx context.Context, c *cli, args []string) error {
+	return sendKey(ctx, c, args, (*client.Client).SendRelease)
+}
+
+func sendKey(ctx context.Context, c *cli, args []string, send func(*client.Client, context.Context, client.KeyRequest) error) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	req, err := client.ParseKeys(args[0])
+	if err != nil {
+		return err
+	}
+	kb, err := c.client()
+	if err != nil {
+		return err
+	}
+	return send(kb, ctx, client.KeyRequest{Device: c.device, Type: req.Type, Code: req.Code, Modifiers: req.Modifiers})
+}
+
+func runReleaseAll(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	kb, err := c.client()
+	if err != nil {
+		return err
+	}
+	return kb.ReleaseAll(ctx, client.ReleaseAllRequest{Device: c.device})
+}
+
+func runConsumer(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("consumer", flag.ContinueOnError)
+	hold := flags.Duration("hold", 0, "")
+	args, err := parseArgs(flags, args)
+	if err != nil || len(args) != 1 {
+		return errUsage
+	}
+	req, err := parseConsumer(args[0])
+	if err != nil {
+		return err
+	}
+	if req.HoldMS, err = holdMS(*hold); err != nil {
+		return err
+	}
+	req.Device = c.device
+	kb, err := c.client()
+	if err != nil {
+		return err
+	}
+	return kb.SendPressAndRelease(ctx, req)
+}
+
+// parseConsumer parses a media control name or usage, with or without the
+// "media:" prefix.
+func parseConsumer(name string) (client.PressAndReleaseRequest, error) {
+	if !strings.Contains(name, ":") {
+		name = "media:" + name
+	}
+	return client.ParseKeys(name)
+}
+
+func runType(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("type", flag.ContinueOnError)
+	layout := flags.String("layout", hid.DefaultLayout, "")
+	args, err := parseArgs(flags, args)
+	if err != nil || len(args) == 0 {
+		return errUsage
+	}
+	steps, err := typeSteps(strings.Join(args, " "), *layout)
+	if err != nil {
+		return err
+	}
+	kb, err := c.client()
+	if err != nil {
+		return err
+	}
+	// Each sequence runs with exclusive access to the bridge and stops at
+	// the first failure.
+	for len(steps) > 0 {
+		n := min(len(steps), maxSequenceSteps)
+		if _, err := kb.SendSequence(ctx, client.SequenceRequest{Device: c.device, Steps: steps[:n]}); err != nil {
+			return err
+		}
+		steps = steps[n:]
+	}
+	return nil
+}
+
+// typeSteps maps text to a keystroke per character, using the keyboard
+// layout configured on the target host.
+func typeSteps(text, layoutName string) ([]client.SequenceStep, error) {
+	layout, err := hid.LookupLayout(layoutName)
+	if err != nil {
+		return nil, err
+	}
+	strokes, err := layout.Translate(text)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]client.SequenceStep, 0, len(strokes))
+	for _, stroke := range strokes {
+		steps = append(steps, client.SequenceStep{
+			Action:    client.ActionPressAndRelease,
+			Type:      "keyboard",
+			Code:      stroke.Code,
+			Modifiers: client.NewModifiers(stroke.Modifiers, false),
+		})
+	}
+	return steps, nil
+}
+
+func runStatus(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	kb, err := c.client()
+	if err != nil {
+		return err
+	}
+	devices, err := kb.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tSTATE\tPORT\tSELECTOR\tLAST ERROR")
+	for _, device := range devices {
+		state := "disconnected"
+		if device.Connected {
+			state = "connected " + (time.Duration(device.ConnectedSeconds) * time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", device.Name, state, device.Port, device.Selector, device.LastError)
+	}
+	return w.Flush()
+}
+
+func runKeys(_ context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("keys", flag.ContinueOnError)
+	consumer := flags.Bool("consumer", false, "")
+	args, err := parseArgs(flags, args)
+	if err != nil || len(args) != 0 {
+		return errUsage
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	if *consumer {
+		fmt.Fprintln(w, "USAGE\tMEDIA CONTROL")
+		writeUsages(w, hid.ConsumerNames(), "media:")
+	} else {
+		fmt.Fprintln(w, "USAGE\tKEY")
+		writeUsages(w, hid.KeyNames(), "")
+		fmt.Fprintf(w, "modifiers\t%s\n", strings.Join(hid.ModifierNames(), ", "))
+	}
+	return w.Flush()
+}
+
+// writeUsages prints one line per usage, with every name it has.
+func writeUsages(w io.Writer, names []string, prefix string) {
+	var codes []uint16
+	byCode := make(map[uint16][]string)
+	for _, name := range names {
+		chord, err := hid.ParseChord(prefix + name)
+		if err != nil {
+			continue
+		}
+		if _, ok := byCode[chord.Code]; !ok {
+			codes = append(codes, chord.Code)
+		}
+		byCode[chord.Code] = append(byCode[chord.Code], name)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "0x%02X\t%s\n", code, strings.Join(byCode[code], ", "))
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/hid"
+)
+
+// scriptStep is a step of a parsed key script, with its line number for
+// error messages.
+type scriptStep struct {
+	line int
+	step client.SequenceStep
+}
+
+// runScript runs a key script over a WebSocket stream, stopping at the
+// first failure. A script has one command per line; blank lines and lines
+// starting with "#" are ignored:
+//
+//	key cmd+space
+//	delay 300ms
+//	type Hello world!
+//	layout de
+//	type Grüße
+//	press shift
+//	release shift
+//	consumer playpause
+//
+// "type" takes the rest of the line verbatim and maps it with the layout
+// set by the last "layout" line (default: --layout).
+func runScript(ctx context.Context, c *cli, args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	layout := flags.String("layout", hid.DefaultLayout, "")
+	args, err := parseArgs(flags, args)
+	if err != nil || len(args) > 1 {
+		return errUsage
+	}
+	input, name := c.stdin, "stdin"
+	if len(args) == 1 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input, name = file, args[0]
+	}
+	steps, err := parseScript(input, name, *layout)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+
+	kb, err := c.client()
+	if err != nil {
+		return err
+	}
+	if c.wait {
+		if err := kb.WaitReady(ctx, c.device); err != nil {
+			return err
+		}
+	}
+	stream, err := kb.OpenStream(ctx, c.device)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	for _, s := range steps {
+		if err := stream.Send(ctx, s.step); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, s.line, err)
+		}
+	}
+	return nil
+}
+
+// parseScript parses and validates a whole script, so that nothing is sent
+// if any line is invalid.
+func parseScript(r io.Reader, name, layout string) ([]scriptStep, error) {
+	var steps []scriptStep
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		command, arg, _ := strings.Cut(strings.TrimLeft(text, " \t"), " ")
+		if command != "type" {
+			arg = strings.TrimSpace(arg)
+		}
+		parsed, err := parseScriptLine(command, arg, &layout)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		for _, step := range parsed {
+			steps = append(steps, scriptStep{line: line, step: step})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	return steps, nil
+}
+
+func parseScriptLine(command, arg string, layout *string) ([]client.SequenceStep, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("%s needs an argument", command)
+	}
+	switch command {
+	case "key", "press", "release":
+		req, err := client.ParseKeys(arg)
+		if err != nil {
+			return nil, err
+		}
+		action := command
+		if command == "key" {
+			action = client.ActionPressAndRelease
+		}
+		return []client.SequenceStep{{Action: action, Type: req.Type, Code: req.Code, Modifiers: req.Modifiers}}, nil
+	case "consumer":
+		req, err := parseConsumer(arg)
+		if err != nil {
+			return nil, err
+		}
+		return []client.SequenceStep{{Action: client.ActionConsumer, Code: req.Code}}, nil
+	case "type":
+		return typeSteps(arg, *layout)
+	case "layout":
+		if _, err := hid.LookupLayout(arg); err != nil {
+			return nil, err
+		}
+		*layout = arg
+		return nil, nil
+	case "delay":
+		delay, err := time.ParseDuration(arg)
+		if err != nil || delay < 0 || delay > time.Minute {
+			return nil, fmt.Errorf("invalid delay %q (expected a duration up to 1m, e.g. 300ms)", arg)
+		}
+		return []client.SequenceStep{{Action: client.ActionDelay, DelayMS: uint32(delay.Milliseconds())}}, nil
+	default:
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+}
@@ -0,0 +1,160 @@
+// Command keybridge-sim simulates a keybridge firmware on a pseudo-terminal.
+//
+// It prints the HID events decoded from the packets keybridged writes and
+// answers with firmware-style log lines, so the daemon can be exercised
+// end-to-end without a bridge board:
+//
+//	keybridge-sim -link /tmp/keybridge
+//	keybridged -path /tmp/keybridge
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/2opremio/keybridged/device"
+)
+
+const defaultBanner = "keybridge-sim ready"
+
+var modifierNames = []string{
+	"left_ctrl",
+	"left_shift",
+	"left_alt",
+	"left_gui",
+	"right_ctrl",
+	"right_shift",
+	"right_alt",
+	"right_gui",
+}
+
+func main() {
+	link := flag.String("link", "", "Optional symlink to create pointing at the pty slave (e.g. /tmp/keybridge)")
+	banner := flag.String("banner", defaultBanner, "Log line sent to keybridged on startup (empty to disable)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+	slog.SetDefault(logger)
+
+	p, err := openPTY()
+	if err != nil {
+		logger.Error("failed to open pty", "error", err)
+		os.Exit(1)
+	}
+	defer p.Close()
+
+	portPath := p.slavePath
+	if *link != "" {
+		if err := os.Remove(*link); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error("failed to remove existing link", "link", *link, "error", err)
+			os.Exit(1)
+		}
+		if err := os.Symlink(p.slavePath, *link); err != nil {
+			logger.Error("failed to create link", "link", *link, "error", err)
+			os.Exit(1)
+		}
+		defer os.Remove(*link)
+		portPath = *link
+	}
+	logger.Info("simulated bridge listening", "pty", p.slavePath, "run", "keybridged -path "+portPath)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *banner != "" {
+		writeLogLine(p.master, *banner)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve(p.master, logger)
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.Info("shutting down")
+	case err := <-errCh:
+		if err != nil && !errors.Is(err, io.EOF) {
+			logger.Error("pty read error", "error", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// serve decodes packets from the pty master until it fails.
+func serve(rw io.ReadWriter, logger *slog.Logger) error {
+	var pending []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := rw.Read(buf)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, buf[:n]...)
+		for len(pending) >= device.PacketLen {
+			packet, err := device.DecodePacket(pending[:device.PacketLen])
+			if err != nil {
+				// Drop a byte and try to resynchronize on the next packet boundary.
+				logger.Warn("invalid packet", "byte", fmt.Sprintf("0x%02X", pending[0]), "error", err)
+				writeLogLine(rw, "E: "+err.Error())
+				pending = pending[1:]
+				continue
+			}
+			pending = pending[device.PacketLen:]
+			logPacket(rw, logger, packet)
+		}
+	}
+}
+
+func logPacket(w io.Writer, logger *slog.Logger, packet device.Packet) {
+	action := "press"
+	if packet.Release {
+		action = "release"
+	}
+	switch packet.Type {
+	case device.PacketKeyboard:
+		appleFn := packet.Flags&device.KeyboardFlagAppleFn != 0
+		logger.Info("keyboard event",
+			"action", action,
+			"usage", fmt.Sprintf("0x%02X", packet.Code),
+			"modifiers", describeModifiers(packet.Modifier),
+			"apple_fn", appleFn,
+		)
+		fn := 0
+		if appleFn {
+			fn = 1
+		}
+		writeLogLine(w, fmt.Sprintf("I: kb %s code=0x%02X mod=0x%02X fn=%d", action, packet.Code, packet.Modifier, fn))
+	case device.PacketConsumer:
+		logger.Info("consumer event",
+			"action", action,
+			"usage", fmt.Sprintf("0x%04X", packet.Code),
+		)
+		writeLogLine(w, fmt.Sprintf("I: consumer %s usage=0x%04X", action, packet.Code))
+	}
+}
+
+func describeModifiers(mask byte) string {
+	var names []string
+	for bit, name := range modifierNames {
+		if mask&(1<<bit) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "+")
+}
+
+func writeLogLine(w io.Writer, line string) {
+	_, _ = io.WriteString(w, line+"\r\n")
+}
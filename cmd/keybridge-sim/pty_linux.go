@@ -0,0 +1,71 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// pty is a pseudo-terminal pair. The simulator talks on master; keybridged
+// opens slavePath as if it were the bridge's serial device.
+type pty struct {
+	master    *os.File
+	slave     *os.File
+	slavePath string
+}
+
+func openPTY() (*pty, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open /dev/ptmx: %w", err)
+	}
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("unlock pty: %w", err)
+	}
+	index, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("get pty number: %w", err)
+	}
+	slavePath := fmt.Sprintf("/dev/pts/%d", index)
+
+	// Keep a slave descriptor open so reads on master don't fail with EIO
+	// while keybridged is disconnected, and put it in raw mode so log lines
+	// written before keybridged opens the port aren't echoed back to us.
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("open %s: %w", slavePath, err)
+	}
+	if err := makeRaw(int(slave.Fd())); err != nil {
+		_ = slave.Close()
+		_ = master.Close()
+		return nil, fmt.Errorf("set raw mode on %s: %w", slavePath, err)
+	}
+	return &pty{master: master, slave: slave, slavePath: slavePath}, nil
+}
+
+func makeRaw(fd int) error {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+}
+
+func (p *pty) Close() error {
+	_ = p.slave.Close()
+	return p.master.Close()
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+type pty struct {
+	master    *os.File
+	slavePath string
+}
+
+func openPTY() (*pty, error) {
+	return nil, errors.New("keybridge-sim is only supported on Linux")
+}
+
+func (p *pty) Close() error {
+	return p.master.Close()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/2opremio/keybridged/client"
+)
+
+// tokensEnv holds API tokens, in the same "name:token" format as
+// -token-file, separated by commas or newlines.
+const tokensEnv = "KEYBRIDGED_TOKENS"
+
+// probePaths are served without authentication, for container and
+// supervisor probes.
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+var errDuplicateToken = errors.New("duplicate token")
+
+// apiToken is a named bearer token. The name identifies the client in logs.
+type apiToken struct {
+	name string
+	// hash is the SHA-256 of the token, so comparisons are constant-time
+	// regardless of token length.
+	hash [sha256.Size]byte
+}
+
+// tokens is the set of accepted bearer tokens. Empty disables authentication.
+type tokens []apiToken
+
+// loadTokens reads tokens from path (if set) and from KEYBRIDGED_TOKENS.
+func loadTokens(path string) (tokens, error) {
+	var list tokens
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open token file: %w", err)
+		}
+		defer file.Close()
+		list, err = parseTokens(file, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if value := os.Getenv(tokensEnv); value != "" {
+		envTokens, err := parseTokens(strings.NewReader(strings.ReplaceAll(value, ",", "\n")), tokensEnv)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, envTokens...)
+	}
+	names := make(map[string]bool, len(list))
+	hashes := make(map[[sha256.Size]byte]bool, len(list))
+	for _, token := range list {
+		if names[token.name] || hashes[token.hash] {
+			return nil, fmt.Errorf("%w: %s", errDuplicateToken, token.name)
+		}
+		names[token.name] = true
+		hashes[token.hash] = true
+	}
+	return list, nil
+}
+
+// parseTokens reads "name:token" lines, skipping blank lines and # comments.
+func parseTokens(r io.Reader, source string) (tokens, error) {
+	var list tokens
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, token, ok := strings.Cut(text, ":")
+		name = strings.TrimSpace(name)
+		token = strings.TrimSpace(token)
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("%s:%d: invalid token entry (expected name:token)", source, line)
+		}
+		list = append(list, apiToken{name: name, hash: sha256.Sum256([]byte(token))})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", source, err)
+	}
+	return list, nil
+}
+
+// lookup returns the name of the token, or false if it isn't accepted.
+func (t tokens) lookup(token string) (string, bool) {
+	hash := sha256.Sum256([]byte(token))
+	name, found := "", false
+	for _, candidate := range t {
+		// Compare against every token so timing doesn't reveal which matched.
+		if subtle.ConstantTimeCompare(hash[:], candidate.hash[:]) == 1 {
+			name, found = candidate.name, true
+		}
+	}
+	return name, found
+}
+
+// authConfig selects how clients authenticate. The zero value disables
+// authentication.
+type authConfig struct {
+	tokens tokens
+	// clientCerts is set when the server verifies client certificates
+	// (mTLS); a verified certificate then authenticates a request without a
+	// token.
+	clientCerts bool
+	// certIdentities maps client certificate common names to client names.
+	// When set, certificates not listed are rejected. Otherwise the common
+	// name is the client name.
+	certIdentities map[string]string
+}
+
+func (a authConfig) enabled() bool {
+	return len(a.tokens) > 0 || a.clientCerts
+}
+
+// authenticator rejects requests without a verified client certificate or
+// one of the accepted bearer tokens, except probes. Requests that send input
+// are logged with the client name. Its configuration can be replaced while
+// serving.
+type authenticator struct {
+	config atomic.Pointer[authConfig]
+	logger *slog.Logger
+}
+
+func newAuthenticator(config authConfig, logger *slog.Logger) *authenticator {
+	a := &authenticator{logger: logger.With("component", "auth")}
+	a.set(config)
+	return a
+}
+
+func (a *authenticator) set(config authConfig) {
+	a.config.Store(&config)
+}
+
+func (a *authenticator) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := a.config.Load()
+		if !auth.enabled() || probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, status := auth.identify(r)
+		if status != http.StatusOK {
+			a.logger.Warn("unauthorized request", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path, "client", name)
+			code := client.CodeForbidden
+			if status == http.StatusUnauthorized {
+				code = client.CodeUnauthorized
+				w.Header().Set("WWW-Authenticate", `Bearer realm="keybridged"`)
+			}
+			writeError(w, status, code, strings.ToLower(http.StatusText(status)))
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path == "/ws" {
+			a.logger.Info("api request", "client", name, "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identify returns the client name of r, with http.StatusOK if it is
+// authenticated, or the status to reject it with.
+func (a authConfig) identify(r *http.Request) (string, int) {
+	if a.clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		commonName := r.TLS.PeerCertificates[0].Subject.CommonName
+		if a.certIdentities == nil {
+			return commonName, http.StatusOK
+		}
+		if name, ok := a.certIdentities[commonName]; ok {
+			return name, http.StatusOK
+		}
+		return "cn=" + commonName, http.StatusForbidden
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") {
+		if name, ok := a.tokens.lookup(strings.TrimSpace(token)); ok {
+			return name, http.StatusOK
+		}
+	}
+	return "", http.StatusUnauthorized
+}
+
+// loadAuth reads the tokens and client certificate names configured in
+// config. clientCerts is set when the server verifies client certificates.
+func loadAuth(config daemonConfig, clientCerts bool) (authConfig, error) {
+	auth := authConfig{clientCerts: clientCerts}
+	var err error
+	auth.tokens, err = loadTokens(config.TokenFile)
+	if err != nil {
+		return auth, err
+	}
+	if config.TLS.clientNamesFile != "" {
+		auth.certIdentities, err = loadClientNames(config.TLS.clientNamesFile)
+		if err != nil {
+			return auth, err
+		}
+	}
+	return auth, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func tokenNames(list tokens) []string {
+	names := make([]string, 0, len(list))
+	for _, token := range list {
+		names = append(names, token.name)
+	}
+	return names
+}
+
+func TestParseTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+		err   string
+	}{
+		{"comments and blank lines", "# clients\n\nlaptop:abc\n  # indented comment\n\tci : def \n", []string{"laptop", "ci"}, ""},
+		{"colon in token", "laptop:abc:def", []string{"laptop"}, ""},
+		{"empty", "", nil, ""},
+		{"blank token", "laptop:abc\nci:  \n", nil, "tokens:2: invalid token entry"},
+		{"blank name", " :abc", nil, "tokens:1: invalid token entry"},
+		{"no separator", "laptop", nil, "tokens:1: invalid token entry"},
+	}
+	for _, test := range tests {
+		list, err := parseTokens(strings.NewReader(test.input), "tokens")
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: parseTokens error = %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseTokens: %v", test.name, err)
+			continue
+		}
+		if got := tokenNames(list); !slices.Equal(got, test.want) {
+			t.Errorf("%s: names = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	list, _ := parseTokens(strings.NewReader("laptop: abc:def "), "tokens")
+	if name, ok := list.lookup("abc:def"); !ok || name != "laptop" {
+		t.Errorf("lookup(abc:def) = %q, %v, want laptop", name, ok)
+	}
+}
+
+func TestLoadTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  string
+		want []string
+		err  error
+	}{
+		{"file and env", "laptop:abc\n", "ci:def,deploy:ghi", []string{"laptop", "ci", "deploy"}, nil},
+		{"env only", "", "ci:def\ndeploy:ghi", []string{"ci", "deploy"}, nil},
+		{"duplicate name", "laptop:abc\n", "laptop:def", nil, errDuplicateToken},
+		{"duplicate token", "laptop:abc\nci:abc\n", "", nil, errDuplicateToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := ""
+			if test.file != "" {
+				path = filepath.Join(t.TempDir(), "tokens")
+				if err := os.WriteFile(path, []byte(test.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv(tokensEnv, test.env)
+			list, err := loadTokens(path)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("loadTokens error = %v, want %v", err, test.err)
+			}
+			if got := tokenNames(list); err == nil && !slices.Equal(got, test.want) {
+				t.Errorf("names = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// certRequest returns a request carrying a verified client certificate
+// with the given common name, and bearer token if set.
+func certRequest(path, commonName, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if commonName != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAuthenticate(t *testing.T) {
+	list := tokens{{name: "laptop", hash: sha256.Sum256([]byte("secret"))}}
+	mapped := map[string]string{"ci.example.com": "ci"}
+
+	tests := []struct {
+		name       string
+		config     authConfig
+		req        *http.Request
+		wantStatus int
+		wantClient string
+	}{
+		{"no token", authConfig{tokens: list}, certRequest("/status", "", ""), http.StatusUnauthorized, ""},
+		{"wrong token", authConfig{tokens: list}, certRequest("/status", "", "guess"), http.StatusUnauthorized, ""},
+		{"token", authConfig{tokens: list}, certRequest("/status", "", "secret"), http.StatusOK, "laptop"},
+		{"healthz probe", authConfig{tokens: list}, certRequest("/healthz", "", ""), http.StatusOK, ""},
+		{"readyz probe", authConfig{tokens: list}, certRequest("/readyz", "", ""), http.StatusOK, ""},
+		{"certificate name", authConfig{clientCerts: true}, certRequest("/status", "ci.example.com", ""), http.StatusOK, "ci.example.com"},
+		{"mapped certificate", authConfig{clientCerts: true, certIdentities: mapped}, certRequest("/status", "ci.example.com", ""), http.StatusOK, "ci"},
+		{"unmapped certificate", authConfig{clientCerts: true, certIdentities: mapped}, certRequest("/status", "other", ""), http.StatusForbidden, "cn=other"},
+		// The certificate identifies the client even when a token is sent.
+		{"certificate and token", authConfig{tokens: list, clientCerts: true, certIdentities: mapped}, certRequest("/status", "ci.example.com", "secret"), http.StatusOK, "ci"},
+		{"certificate and wrong token", authConfig{tokens: list, clientCerts: true}, certRequest("/status", "ci.example.com", "guess"), http.StatusOK, "ci.example.com"},
+		{"unmapped certificate and token", authConfig{tokens: list, clientCerts: true, certIdentities: mapped}, certRequest("/status", "other", "secret"), http.StatusForbidden, "cn=other"},
+		{"token without certificate", authConfig{tokens: list, clientCerts: true}, certRequest("/status", "", "secret"), http.StatusOK, "laptop"},
+	}
+	for _, test := range tests {
+		if !probePaths[test.req.URL.Path] {
+			name, status := test.config.identify(test.req)
+			if status != test.wantStatus || name != test.wantClient {
+				t.Errorf("%s: identify = %q, %d, want %q, %d", test.name, name, status, test.wantClient, test.wantStatus)
+			}
+		}
+		handler := newAuthenticator(test.config, slog.New(slog.DiscardHandler)).wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, test.req)
+		if recorder.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, recorder.Code, test.wantStatus)
+		}
+	}
+}
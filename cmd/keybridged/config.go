@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+)
+
+// daemonConfig is the daemon configuration, from flags or a -config file.
+type daemonConfig struct {
+	Host string
+	// Port is the TCP port, 0 to only listen on Unix.path.
+	Port        int
+	Unix        unixSocketOptions
+	TLS         tlsOptions
+	TokenFile   string
+	SendTimeout time.Duration
+	LogBacklog  int
+	LogLevel    slog.Level
+	// LogFormat is "text" or "json".
+	LogFormat string
+	Webhooks  []string
+	Devices   []deviceSpec
+}
+
+// restartRequired returns the settings that differ between c and next and
+// only take effect after a restart.
+func (c daemonConfig) restartRequired(next daemonConfig) []string {
+	var keys []string
+	if c.Host != next.Host || c.Port != next.Port || c.Unix != next.Unix {
+		keys = append(keys, "listen")
+	}
+	if c.TLS.certFile != next.TLS.certFile || c.TLS.keyFile != next.TLS.keyFile || c.TLS.clientCAFile != next.TLS.clientCAFile {
+		keys = append(keys, "tls")
+	}
+	if c.SendTimeout != next.SendTimeout {
+		keys = append(keys, "send_timeout")
+	}
+	if c.LogBacklog != next.LogBacklog {
+		keys = append(keys, "log_backlog")
+	}
+	if c.LogFormat != next.LogFormat {
+		keys = append(keys, "logging.format")
+	}
+	return keys
+}
+
+// configFile is the JSON layout of a -config file. Every key is optional.
+type configFile struct {
+	Listen *struct {
+		Host            *string `json:"host"`
+		Port            *int    `json:"port"`
+		UnixSocket      string  `json:"unix_socket"`
+		UnixSocketMode  string  `json:"unix_socket_mode"`
+		UnixSocketGroup string  `json:"unix_socket_group"`
+	} `json:"listen"`
+	TLS *struct {
+		Cert        string `json:"cert"`
+		Key         string `json:"key"`
+		ClientCA    string `json:"client_ca"`
+		ClientNames string `json:"client_names"`
+	} `json:"tls"`
+	Auth *struct {
+		TokenFile string `json:"token_file"`
+	} `json:"auth"`
+	SendTimeout *string `json:"send_timeout"`
+	LogBacklog  *int    `json:"log_backlog"`
+	Logging     *struct {
+		Level  string `json:"level"`
+		Format string `json:"format"`
+	} `json:"logging"`
+	Webhooks []string           `json:"webhooks"`
+	Devices  []configFileDevice `json:"devices"`
+}
+
+type configFileDevice struct {
+	Name     string `json:"name"`
+	VID      string `json:"vid"`
+	PID      string `json:"pid"`
+	Path     string `json:"path"`
+	Serial   string `json:"serial"`
+	Product  string `json:"product"`
+	BaudRate int    `json:"baud_rate"`
+	DataBits int    `json:"data_bits"`
+	Parity   string `json:"parity"`
+	// StopBits is 1, 1.5 or 2.
+	StopBits *float64 `json:"stop_bits"`
+	DTR      *bool    `json:"dtr"`
+	RTS      *bool    `json:"rts"`
+	Pulse    string   `json:"pulse"`
+}
+
+// configError is a configuration error at a key path such as
+// "devices[1].vid".
+type configError struct {
+	Key string
+	Err error
+}
+
+func (e *configError) Error() string {
+	if e.Key == "" {
+		return e.Err.Error()
+	}
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.Err
+}
+
+func keyError(key string, format string, args ...any) error {
+	return &configError{Key: key, Err: fmt.Errorf(format, args...)}
+}
+
+// defaultConfig returns the configuration used for unset flags and keys.
+func defaultConfig() daemonConfig {
+	return daemonConfig{
+		Host:        defaultHost,
+		Port:        defaultPort,
+		Unix:        unixSocketOptions{mode: fmt.Sprintf("%04o", defaultUnixSocketMode)},
+		SendTimeout: defaultSendTimeoutS * time.Second,
+		LogBacklog:  device.DefaultLogBacklog,
+		LogLevel:    slog.LevelInfo,
+		LogFormat:   "text",
+	}
+}
+
+// loadConfigFile reads and validates a -config file.
+func loadConfigFile(path string) (daemonConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return daemonConfig{}, err
+	}
+	config, err := parseConfig(data)
+	if err != nil {
+		return daemonConfig{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+func parseConfig(data []byte) (daemonConfig, error) {
+	config := defaultConfig()
+	if len(bytes.TrimSpace(data)) == 0 {
+		return config, keyError("", "empty configuration file")
+	}
+	var file configFile
+	// checkJSON reports unknown keys and type mismatches with their path,
+	// which json.Unmarshal doesn't; after it passes, Unmarshal can't fail.
+	if err := checkJSON(data, reflect.TypeOf(file), ""); err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return config, keyError("", "%v", err)
+	}
+
+	if listen := file.Listen; listen != nil {
+		if listen.Host != nil {
+			config.Host = strings.TrimSpace(*listen.Host)
+		}
+		if listen.Port != nil {
+			if *listen.Port < 0 || *listen.Port > 65535 {
+				return config, keyError("listen.port", "must be between 0 and 65535")
+			}
+			config.Port = *listen.Port
+		}
+		config.Unix.path = strings.TrimSpace(listen.UnixSocket)
+		if listen.UnixSocketMode != "" {
+			if _, err := parseSocketMode(listen.UnixSocketMode); err != nil {
+				return config, keyError("listen.unix_socket_mode", "%v", err)
+			}
+			config.Unix.mode = listen.UnixSocketMode
+		}
+		config.Unix.group = strings.TrimSpace(listen.UnixSocketGroup)
+		if config.Port == 0 && config.Unix.path == "" {
+			return config, keyError("listen.port", "0 requires listen.unix_socket")
+		}
+	}
+	if tlsFile := file.TLS; tlsFile != nil {
+		config.TLS = tlsOptions{
+			certFile:        tlsFile.Cert,
+			keyFile:         tlsFile.Key,
+			clientCAFile:    tlsFile.ClientCA,
+			clientNamesFile: tlsFile.ClientNames,
+		}
+		if (config.TLS.certFile == "") != (config.TLS.keyFile == "") {
+			return config, keyError("tls", "cert and key must be set together")
+		}
+		if config.TLS.clientCAFile != "" && config.TLS.certFile == "" {
+			return config, keyError("tls.client_ca", "requires tls.cert and tls.key")
+		}
+		if config.TLS.clientNamesFile != "" && config.TLS.clientCAFile == "" {
+			return config, keyError("tls.client_names", "requires tls.client_ca")
+		}
+	}
+	if file.Auth != nil {
+		config.TokenFile = strings.TrimSpace(file.Auth.TokenFile)
+	}
+	if file.SendTimeout != nil {
+		timeout, err := time.ParseDuration(*file.SendTimeout)
+		if err != nil || timeout <= 0 {
+			return config, keyError("send_timeout", "invalid duration %q (expected e.g. \"2s\")", *file.SendTimeout)
+		}
+		config.SendTimeout = timeout
+	}
+	if file.LogBacklog != nil {
+		if *file.LogBacklog <= 0 {
+			return config, keyError("log_backlog", "must be positive")
+		}
+		config.LogBacklog = *file.LogBacklog
+	}
+	if logging := file.Logging; logging != nil {
+		if logging.Level != "" {
+			if err := config.LogLevel.UnmarshalText([]byte(logging.Level)); err != nil {
+				return config, keyError("logging.level", "invalid level %q (expected debug, info, warn or error)", logging.Level)
+			}
+		}
+		if logging.Format != "" {
+			if logging.Format != "text" && logging.Format != "json" {
+				return config, keyError("logging.format", "invalid format %q (expected text or json)", logging.Format)
+			}
+			config.LogFormat = logging.Format
+		}
+	}
+	for i, value := range file.Webhooks {
+		webhook, err := parseWebhookURL(value)
+		if err != nil {
+			return config, keyError(fmt.Sprintf("webhooks[%d]", i), "%v", err)
+		}
+		config.Webhooks = append(config.Webhooks, webhook)
+	}
+	names := make(map[string]bool, len(file.Devices))
+	for i, entry := range file.Devices {
+		key := fmt.Sprintf("devices[%d]", i)
+		spec, err := entry.spec(key)
+		if err != nil {
+			return config, err
+		}
+		if names[spec.Name] {
+			return config, keyError(key+".name", "%w: %s", errDuplicateDevice, spec.Name)
+		}
+		names[spec.Name] = true
+		config.Devices = append(config.Devices, spec)
+	}
+	if len(config.Devices) == 0 {
+		config.Devices = []deviceSpec{{Name: defaultDeviceName}}
+	}
+	return config, nil
+}
+
+func (d configFileDevice) spec(key string) (deviceSpec, error) {
+	spec := deviceSpec{
+		Name: strings.TrimSpace(d.Name),
+		Selector: device.Selector{
+			Path:         strings.TrimSpace(d.Path),
+			SerialNumber: strings.TrimSpace(d.Serial),
+			Product:      strings.TrimSpace(d.Product),
+		},
+		Serial: device.SerialMode{
+			BaudRate: d.BaudRate,
+			DataBits: d.DataBits,
+		},
+	}
+	if spec.Name == "" {
+		return spec, keyError(key+".name", "is required")
+	}
+	var err error
+	if d.VID != "" {
+		if spec.Selector.VID, err = parseUSBID(d.VID); err != nil {
+			return spec, keyError(key+".vid", "invalid USB ID %q", d.VID)
+		}
+	}
+	if d.PID != "" {
+		if spec.Selector.PID, err = parseUSBID(d.PID); err != nil {
+			return spec, keyError(key+".pid", "invalid USB ID %q", d.PID)
+		}
+	}
+	if d.Parity != "" {
+		if spec.Serial.Parity, err = device.ParseParity(d.Parity); err != nil {
+			return spec, keyError(key+".parity", "%v", err)
+		}
+	}
+	if d.StopBits != nil {
+		value := strconv.FormatFloat(*d.StopBits, 'f', -1, 64)
+		if spec.Serial.StopBits, err = device.ParseStopBits(value); err != nil {
+			return spec, keyError(key+".stop_bits", "%v", err)
+		}
+	}
+	if d.DTR != nil && !*d.DTR {
+		spec.Serial.DTR = device.LineOff
+	}
+	if d.RTS != nil && !*d.RTS {
+		spec.Serial.RTS = device.LineOff
+	}
+	if d.Pulse != "" {
+		if spec.Serial.Pulse, err = parsePulse(d.Pulse); err != nil {
+			return spec, keyError(key+".pulse", "%v", err)
+		}
+	}
+	if err := spec.validate(); err != nil {
+		return spec, keyError(key, "%v", err)
+	}
+	return spec, nil
+}
+
+// checkJSON checks that data has the layout of t: no unknown keys, and
+// values of the right JSON type.
+func checkJSON(data json.RawMessage, t reflect.Type, key string) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return checkJSON(data, t.Elem(), key)
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return keyError(key, "expected an object")
+		}
+		known := make(map[string]reflect.Type, t.NumField())
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			known[name] = field.Type
+		}
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			fieldKey := name
+			if key != "" {
+				fieldKey = key + "." + name
+			}
+			fieldType, ok := known[name]
+			if !ok {
+				return keyError(fieldKey, "unknown key")
+			}
+			if err := checkJSON(fields[name], fieldType, fieldKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return keyError(key, "expected an array")
+		}
+		for i, item := range items {
+			if err := checkJSON(item, t.Elem(), key+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if err := json.Unmarshal(data, reflect.New(t).Interface()); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return keyError(key, "expected %s, got %s", jsonTypeName(t), typeErr.Value)
+			}
+			return keyError(key, "%v", err)
+		}
+		return nil
+	}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64, reflect.Uint16:
+		return "an integer"
+	case reflect.Float64:
+		return "a number"
+	default:
+		return t.String()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig([]byte(`{
+		"listen": {"host": "0.0.0.0", "port": 9000},
+		"send_timeout": "3s",
+		"logging": {"level": "debug"},
+		"devices": [
+			{"name": "ipad", "serial": "8F3A1C2D", "baud_rate": 9600, "stop_bits": 2, "dtr": false},
+			{"name": "mac", "vid": "0x1915", "pid": "0x520F"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if config.Host != "0.0.0.0" || config.Port != 9000 || config.SendTimeout != 3*time.Second || config.LogLevel != slog.LevelDebug {
+		t.Errorf("config = %+v", config)
+	}
+	want := []deviceSpec{
+		{Name: "ipad", Selector: device.Selector{SerialNumber: "8F3A1C2D"}, Serial: device.SerialMode{BaudRate: 9600, StopBits: device.StopBits2, DTR: device.LineOff}},
+		{Name: "mac", Selector: device.Selector{VID: 0x1915, PID: 0x520F}},
+	}
+	if len(config.Devices) != len(want) || config.Devices[0] != want[0] || config.Devices[1] != want[1] {
+		t.Errorf("devices = %+v, want %+v", config.Devices, want)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		key    string
+		want   string
+	}{
+		{``, "", "empty configuration file"},
+		{`[]`, "", "expected an object"},
+		{`{"listn": {}}`, "listn", "unknown key"},
+		{`{"listen": {"prot": 1}}`, "listen.prot", "unknown key"},
+		{`{"listen": {"port": "80"}}`, "listen.port", "expected an integer, got string"},
+		{`{"listen": {"port": 70000}}`, "listen.port", "between 0 and 65535"},
+		{`{"logging": []}`, "logging", "expected an object"},
+		{`{"logging": {"level": "loud"}}`, "logging.level", "invalid level"},
+		{`{"send_timeout": 2}`, "send_timeout", "expected a string, got number"},
+		{`{"send_timeout": "soon"}`, "send_timeout", "invalid duration"},
+		{`{"webhooks": ["ftp://example.com"]}`, "webhooks[0]", "invalid webhook URL"},
+		{`{"devices": {}}`, "devices", "expected an array"},
+		{`{"devices": [{"name": "a"}, {"name": "b", "vid": 6421}]}`, "devices[1].vid", "expected a string, got number"},
+		{`{"devices": [{"name": "a", "dtr": "yes"}]}`, "devices[0].dtr", "expected true or false"},
+		{`{"devices": [{"name": "a", "baudrate": 9600}]}`, "devices[0].baudrate", "unknown key"},
+		{`{"devices": [{"vid": "0x1915"}]}`, "devices[0].name", "is required"},
+		{`{"devices": [{"name": "a", "vid": "zz"}]}`, "devices[0].vid", "invalid USB ID"},
+		{`{"devices": [{"name": "a", "stop_bits": 3}]}`, "devices[0].stop_bits", "stop bits"},
+		{`{"devices": [{"name": "a", "data_bits": 9}]}`, "devices[0]", "invalid data bits 9"},
+		{`{"devices": [{"name": "a", "baud_rate": -1}]}`, "devices[0]", "baud rate must be positive"},
+		{`{"devices": [{"name": "a"}, {"name": "a"}]}`, "devices[1].name", "duplicate device name"},
+	}
+	for _, test := range tests {
+		_, err := parseConfig([]byte(test.config))
+		var configErr *configError
+		if !errors.As(err, &configErr) {
+			t.Errorf("parseConfig(%s) = %v, want a configError", test.config, err)
+			continue
+		}
+		if configErr.Key != test.key || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseConfig(%s) = %q at %q, want %q at %q", test.config, err, configErr.Key, test.want, test.key)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+)
+
+const defaultDeviceName = "default"
+
+var (
+	errUnknownDevice   = errors.New("unknown device")
+	errDeviceRequired  = errors.New("device is required when several bridges are configured")
+	errDuplicateDevice = errors.New("duplicate device name")
+	errDeviceBusy      = errors.New("device busy")
+)
+
+// deviceSpec describes one configured bridge.
+type deviceSpec struct {
+	Name     string
+	Selector device.Selector
+	Serial   device.SerialMode
+}
+
+// deviceFlags collects repeated -device flags of the form
+// "name=desk,serial=8F3A1C2D,vid=0x1915,pid=0x520F,path=/dev/ttyACM0,product=nRF,baud=115200",
+// optionally with databits, parity, stopbits, dtr, rts and pulse.
+type deviceFlags []deviceSpec
+
+func (f *deviceFlags) String() string {
+	parts := make([]string, 0, len(*f))
+	for _, spec := range *f {
+		parts = append(parts, spec.Name+": "+spec.Selector.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (f *deviceFlags) Set(value string) error {
+	spec, err := parseDeviceSpec(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, spec)
+	return nil
+}
+
+func parseDeviceSpec(value string) (deviceSpec, error) {
+	var spec deviceSpec
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return spec, fmt.Errorf("invalid device field %q (expected key=value)", field)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+		switch key {
+		case "name":
+			spec.Name = val
+		case "vid", "pid":
+			id, err := parseUSBID(val)
+			if err != nil {
+				return spec, fmt.Errorf("invalid %s %q: %w", key, val, err)
+			}
+			if key == "vid" {
+				spec.Selector.VID = id
+			} else {
+				spec.Selector.PID = id
+			}
+		case "path":
+			spec.Selector.Path = val
+		case "serial":
+			spec.Selector.SerialNumber = val
+		case "product":
+			spec.Selector.Product = val
+		case "baud", "databits", "parity", "stopbits", "dtr", "rts", "pulse":
+			if err := setSerialField(&spec.Serial, key, val); err != nil {
+				return spec, err
+			}
+		default:
+			return spec, fmt.Errorf("unknown device field %q", key)
+		}
+	}
+	if spec.Name == "" {
+		return spec, errors.New("device name is required")
+	}
+	if err := spec.validate(); err != nil {
+		return spec, fmt.Errorf("device %q: %w", spec.Name, err)
+	}
+	return spec, nil
+}
+
+// validate checks the selector and serial settings of the spec.
+func (s deviceSpec) validate() error {
+	if err := s.Selector.Validate(); err != nil {
+		return err
+	}
+	return s.Serial.Validate()
+}
+
+// validateSpecs checks every spec, and that their names are unique.
+func validateSpecs(specs []deviceSpec) error {
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if seen[spec.Name] {
+			return fmt.Errorf("%w: %s", errDuplicateDevice, spec.Name)
+		}
+		seen[spec.Name] = true
+		if err := spec.validate(); err != nil {
+			return fmt.Errorf("device %q: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// setSerialField sets a serial mode setting from its -device key.
+func setSerialField(mode *device.SerialMode, key, value string) error {
+	var err error
+	switch key {
+	case "baud":
+		mode.BaudRate, err = parseBaudRate(value)
+	case "databits":
+		mode.DataBits, err = parseDataBits(value)
+	case "parity":
+		mode.Parity, err = device.ParseParity(value)
+	case "stopbits":
+		mode.StopBits, err = device.ParseStopBits(value)
+	case "dtr":
+		mode.DTR, err = device.ParseLine(value)
+	case "rts":
+		mode.RTS, err = device.ParseLine(value)
+	case "pulse":
+		mode.Pulse, err = parsePulse(value)
+	}
+	return err
+}
+
+func parseBaudRate(value string) (int, error) {
+	baud, err := strconv.Atoi(value)
+	if err != nil || baud <= 0 {
+		return 0, fmt.Errorf("invalid baud rate %q", value)
+	}
+	return baud, nil
+}
+
+func parseDataBits(value string) (int, error) {
+	bits, err := strconv.Atoi(value)
+	if err != nil || bits < 5 || bits > 8 {
+		return 0, fmt.Errorf("invalid data bits %q (expected 5 to 8)", value)
+	}
+	return bits, nil
+}
+
+func parsePulse(value string) (time.Duration, error) {
+	pulse, err := time.ParseDuration(value)
+	if err != nil || pulse < 0 {
+		return 0, fmt.Errorf("invalid pulse %q (expected a duration such as 100ms)", value)
+	}
+	return pulse, nil
+}
+
+// bridge is a named device.Manager served by the daemon.
+type bridge struct {
+	name    string
+	spec    deviceSpec
+	manager *device.Manager
+	// busy is held while a request sends to the bridge, so that multi-packet
+	// requests (typing, sequences) aren't interleaved with other clients'.
+	busy chan struct{}
+}
+
+// acquire waits for exclusive access to the bridge. The returned function
+// gives it back.
+func (b *bridge) acquire(ctx context.Context) (func(), error) {
+	select {
+	case b.busy <- struct{}{}:
+		return func() { <-b.busy }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", errDeviceBusy, ctx.Err())
+	}
+}
+
+// bridges routes requests to the configured bridges by name. The set of
+// bridges changes when the configuration is reloaded.
+type bridges struct {
+	mu     sync.RWMutex
+	list   []*bridge
+	byName map[string]*bridge
+}
+
+func newBridges() *bridges {
+	return &bridges{byName: make(map[string]*bridge)}
+}
+
+// all returns the current bridges, in configuration order.
+func (b *bridges) all() []*bridge {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return slices.Clone(b.list)
+}
+
+// names returns the names of the current bridges, in configuration order.
+func (b *bridges) names() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	names := make([]string, 0, len(b.list))
+	for _, entry := range b.list {
+		names = append(names, entry.name)
+	}
+	return names
+}
+
+// apply makes the bridges match specs: bridges whose spec is unchanged keep
+// running, changed ones are restarted, new ones started with start and
+// removed ones closed. It returns the names of the bridges that were
+// started, restarted or closed. If specs don't pass validateSpecs, nothing
+// changes.
+func (b *bridges) apply(specs []deviceSpec, start func(deviceSpec) *device.Manager) ([]string, error) {
+	if err := validateSpecs(specs); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		seen[spec.Name] = true
+	}
+
+	b.mu.Lock()
+	var (
+		changed  []string
+		obsolete []*bridge
+		list     = make([]*bridge, 0, len(specs))
+		byName   = make(map[string]*bridge, len(specs))
+	)
+	for _, spec := range specs {
+		entry, ok := b.byName[spec.Name]
+		if ok && entry.spec == spec {
+			list = append(list, entry)
+			byName[spec.Name] = entry
+			continue
+		}
+		if ok {
+			obsolete = append(obsolete, entry)
+		}
+		changed = append(changed, spec.Name)
+		entry = &bridge{name: spec.Name, spec: spec, busy: make(chan struct{}, 1)}
+		list = append(list, entry)
+		byName[spec.Name] = entry
+	}
+	for _, entry := range b.list {
+		if !seen[entry.name] {
+			obsolete = append(obsolete, entry)
+			changed = append(changed, entry.name)
+		}
+	}
+	b.mu.Unlock()
+
+	// Close replaced bridges before starting their successors, so that both
+	// don't hold the same serial port.
+	for _, entry := range obsolete {
+		entry.manager.Close()
+	}
+	for _, entry := range list {
+		if entry.manager == nil {
+			entry.manager = start(entry.spec)
+		}
+	}
+
+	b.mu.Lock()
+	b.list = list
+	b.byName = byName
+	b.mu.Unlock()
+	return changed, nil
+}
+
+// lookup returns the named bridge. An empty name selects the only bridge
+// when exactly one is configured.
+func (b *bridges) lookup(name string) (*bridge, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	name = strings.TrimSpace(name)
+	if name == "" {
+		if len(b.list) == 1 {
+			return b.list[0], nil
+		}
+		return nil, errDeviceRequired
+	}
+	entry, ok := b.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownDevice, name)
+	}
+	return entry, nil
+}
+
+func (b *bridges) close() {
+	for _, entry := range b.all() {
+		entry.manager.Close()
+	}
+}
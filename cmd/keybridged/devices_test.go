@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+// recordingStarter starts managers for unplugged fake bridges and records
+// the names started.
+type recordingStarter struct {
+	started []string
+}
+
+func (s *recordingStarter) start(spec deviceSpec) *device.Manager {
+	s.started = append(s.started, spec.Name)
+	return device.NewManager(device.Config{
+		Name:   spec.Name,
+		Dialer: devicetest.NewBridge(devicetest.Config{Unplugged: true}),
+		Logger: slog.New(slog.DiscardHandler),
+	})
+}
+
+// managers returns the manager of every bridge by name.
+func managers(devices *bridges) map[string]*device.Manager {
+	byName := make(map[string]*device.Manager)
+	for _, entry := range devices.all() {
+		byName[entry.name] = entry.manager
+	}
+	return byName
+}
+
+// closed reports whether manager has been closed, which ends its log
+// subscriptions.
+func closed(manager *device.Manager) bool {
+	lines, cancel := manager.SubscribeLogs(0)
+	defer cancel()
+	select {
+	case _, ok := <-lines:
+		return !ok
+	default:
+		return false
+	}
+}
+
+func TestBridgesApply(t *testing.T) {
+	devices := newBridges()
+	defer devices.close()
+	ipad := deviceSpec{Name: "ipad", Selector: device.Selector{SerialNumber: "AAA"}}
+	mac := deviceSpec{Name: "mac", Selector: device.Selector{SerialNumber: "BBB"}}
+	tv := deviceSpec{Name: "tv", Selector: device.Selector{SerialNumber: "CCC"}}
+	movedIPad := ipad
+	movedIPad.Selector = device.Selector{Path: "/dev/ttyACM1"}
+
+	steps := []struct {
+		name        string
+		specs       []deviceSpec
+		wantChanged []string
+		wantStarted []string
+		wantNames   []string
+	}{
+		{"added", []deviceSpec{ipad, mac}, []string{"ipad", "mac"}, []string{"ipad", "mac"}, []string{"ipad", "mac"}},
+		{"same", []deviceSpec{ipad, mac}, nil, nil, []string{"ipad", "mac"}},
+		{"changed", []deviceSpec{movedIPad, mac}, []string{"ipad"}, []string{"ipad"}, []string{"ipad", "mac"}},
+		{"removed and added", []deviceSpec{mac, tv}, []string{"tv", "ipad"}, []string{"tv"}, []string{"mac", "tv"}},
+	}
+	for _, step := range steps {
+		var starter recordingStarter
+		before := managers(devices)
+		changed, err := devices.apply(step.specs, starter.start)
+		if err != nil {
+			t.Fatalf("%s: apply: %v", step.name, err)
+		}
+		if !slices.Equal(changed, step.wantChanged) || !slices.Equal(starter.started, step.wantStarted) {
+			t.Errorf("%s: changed %q and started %q, want %q and %q", step.name, changed, starter.started, step.wantChanged, step.wantStarted)
+		}
+		if names := devices.names(); !slices.Equal(names, step.wantNames) {
+			t.Errorf("%s: names = %q, want %q", step.name, names, step.wantNames)
+		}
+		after := managers(devices)
+		for name, manager := range before {
+			restarted := slices.Contains(step.wantChanged, name)
+			if kept := after[name] == manager; kept == restarted {
+				t.Errorf("%s: %s kept = %v, want %v", step.name, name, kept, !restarted)
+			}
+			if closed(manager) != restarted {
+				t.Errorf("%s: %s closed = %v, want %v", step.name, name, closed(manager), restarted)
+			}
+		}
+	}
+}
+
+func TestBridgesApplyInvalid(t *testing.T) {
+	devices := newBridges()
+	defer devices.close()
+	var starter recordingStarter
+	if _, err := devices.apply([]deviceSpec{{Name: "ipad"}}, starter.start); err != nil {
+		t.Fatal(err)
+	}
+	before := managers(devices)
+
+	tests := []struct {
+		name  string
+		specs []deviceSpec
+		err   error
+	}{
+		{"duplicate", []deviceSpec{{Name: "mac"}, {Name: "mac"}}, errDuplicateDevice},
+		{"serial mode", []deviceSpec{{Name: "mac", Serial: device.SerialMode{DataBits: 9}}}, nil},
+	}
+	for _, test := range tests {
+		starter.started = nil
+		_, err := devices.apply(test.specs, starter.start)
+		if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("%s: apply = %v, want an error", test.name, err)
+		}
+		if len(starter.started) != 0 || closed(before["ipad"]) || !slices.Equal(devices.names(), []string{"ipad"}) {
+			t.Errorf("%s: an invalid configuration changed the bridges", test.name)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+)
+
+var (
+	errUnsupportedType = errors.New("unsupported type")
+	errCodeOutOfRange  = errors.New("code out of range")
+)
+
+// writeError writes a JSON error response (client.ErrorResponse).
+func writeError(w http.ResponseWriter, status int, code client.ErrorCode, message string) {
+	writeErrorDetail(w, status, client.ErrorDetail{Code: code, Message: message})
+}
+
+func writeErrorDetail(w http.ResponseWriter, status int, detail client.ErrorDetail) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(client.ErrorResponse{Error: detail})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, client.CodeMethodNotAllowed, "method not allowed")
+}
+
+// writeRequestError writes a 400 response for a request that failed
+// validation.
+func writeRequestError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusBadRequest, requestErrorCode(err), err.Error())
+}
+
+func requestErrorCode(err error) client.ErrorCode {
+	switch {
+	case errors.Is(err, errUnsupportedType):
+		return client.CodeUnsupportedType
+	case errors.Is(err, errCodeOutOfRange):
+		return client.CodeOutOfRange
+	default:
+		return client.CodeInvalidRequest
+	}
+}
+
+// writeSendError writes a 503 response for events that couldn't be sent to
+// the bridge. Errors wrapping device.ErrNotSent are flagged as not sent.
+func writeSendError(w http.ResponseWriter, action string, err error) {
+	if errors.Is(err, device.ErrNotSent) {
+		writeNotSentError(w, action, err)
+		return
+	}
+	writeError(w, http.StatusServiceUnavailable, sendErrorCode(err), action+" failed: "+err.Error())
+}
+
+// partlySentError is a send error after part of a request reached the
+// bridge. It matches the same errors as its cause except device.ErrNotSent.
+type partlySentError struct {
+	error
+}
+
+func (e partlySentError) Is(target error) bool {
+	return target != device.ErrNotSent && errors.Is(e.error, target)
+}
+
+// writeNotSentError is writeSendError for requests that failed before
+// anything was sent to the bridge, flagged so clients can safely retry them.
+func writeNotSentError(w http.ResponseWriter, action string, err error) {
+	writeErrorDetail(w, http.StatusServiceUnavailable, client.ErrorDetail{
+		Code:    sendErrorCode(err),
+		Message: action + " failed: " + err.Error(),
+		NotSent: true,
+	})
+}
+
+func sendErrorCode(err error) client.ErrorCode {
+	switch {
+	case errors.Is(err, device.ErrClosed):
+		return client.CodeDeviceClosed
+	case errors.Is(err, errDeviceBusy), errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return client.CodeQueueTimeout
+	default:
+		// ErrNotConnected, or a serial port write error after which the
+		// Manager reconnects.
+		return client.CodeDeviceDisconnected
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/hid"
+)
+
+// maxHoldMS bounds hold_ms so a request can't pin a key down indefinitely;
+// use /press and /release for longer holds.
+const maxHoldMS = 60000
+
+// maxTypeRunes bounds the text accepted by /type.
+const maxTypeRunes = 4096
+
+// maxTypeDuration bounds how long typing a text may hold the bridge.
+const maxTypeDuration = time.Minute
+
+type pressReleaseResponse struct {
+	Status string `json:"status"`
+}
+
+// newHandler serves the API, behind auth. Requests are counted for /metrics
+// before authentication, so rejected ones are counted too.
+func newHandler(devices *bridges, sendTimeout time.Duration, auth *authenticator) http.Handler {
+	requests := newHTTPMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pressandrelease", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		req, err := decodeEventRequest(r)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		event, err := newKeyEvent(req.Type, req.Code, req.Modifiers)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		servePressAndRelease(w, r, devices, sendTimeout, req.Device, event, req.HoldMS)
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		var req client.KeysRequest
+		if err := decodeJSONBody(r, &req, false); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		chord, err := hid.ParseChord(req.Keys)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		event, err := chordKeyEvent(chord)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		servePressAndRelease(w, r, devices, sendTimeout, req.Device, event, req.HoldMS)
+	})
+	mux.HandleFunc("/press", keyHandler(devices, sendTimeout, false))
+	mux.HandleFunc("/release", keyHandler(devices, sendTimeout, true))
+	mux.HandleFunc("/type", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		var req client.TypeRequest
+		if err := decodeJSONBody(r, &req, false); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		if req.Text == "" {
+			writeError(w, http.StatusBadRequest, client.CodeInvalidRequest, "missing text")
+			return
+		}
+		if utf8.RuneCountInString(req.Text) > maxTypeRunes {
+			writeError(w, http.StatusBadRequest, client.CodeInvalidRequest, fmt.Sprintf("text must not exceed %d characters", maxTypeRunes))
+			return
+		}
+		layout, err := hid.LookupLayout(req.Layout)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		strokes, err := layout.Translate(req.Text)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		target, ok := lookupDevice(w, devices, req.Device)
+		if !ok {
+			return
+		}
+		unlock, ok := acquireDevice(r.Context(), w, target, sendTimeout)
+		if !ok {
+			return
+		}
+		defer unlock()
+		if err := typeStrokes(r.Context(), target.manager, strokes, sendTimeout); err != nil {
+			writeSendError(w, "send", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pressReleaseResponse{Status: "ok"})
+	})
+	mux.HandleFunc("/sequence", sequenceHandler(devices, sendTimeout))
+	mux.HandleFunc("/ws", streamHandler(devices, sendTimeout))
+	mux.HandleFunc("/releaseall", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		var req client.ReleaseAllRequest
+		if err := decodeJSONBody(r, &req, true); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		// Without a device, release everything on every bridge. This doesn't
+		// wait for exclusive access: it is the way out of a stuck sequence.
+		targets := devices.all()
+		if strings.TrimSpace(req.Device) != "" {
+			target, ok := lookupDevice(w, devices, req.Device)
+			if !ok {
+				return
+			}
+			targets = []*bridge{target}
+		}
+		sendCtx, cancel := context.WithTimeout(r.Context(), sendTimeout)
+		defer cancel()
+		var errs []error
+		for _, target := range targets {
+			if err := target.manager.ReleaseAll(sendCtx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", target.name, err))
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			writeSendError(w, "release", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pressReleaseResponse{Status: "ok"})
+	})
+	mux.HandleFunc("/metrics", metricsHandler(devices, requests))
+	mux.HandleFunc("/status", statusHandler(devices))
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler(devices))
+	mux.HandleFunc("/logs", logsHandler(devices))
+	mux.HandleFunc("/logs/stream", logStreamHandler(devices))
+	mux.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w)
+			return
+		}
+		list := devices.all()
+		resp := client.DevicesResponse{Devices: make([]client.DeviceInfo, 0, len(list))}
+		for _, entry := range list {
+			status := entry.manager.Status()
+			resp.Devices = append(resp.Devices, client.DeviceInfo{
+				Name:      entry.name,
+				Selector:  status.Selector.String(),
+				Connected: status.Connected,
+				Port:      status.Port,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	return requests.wrap(auth.wrap(mux))
+}
+
+// servePressAndRelease sends a validated event to the named bridge, holding
+// it for holdMS milliseconds.
+func servePressAndRelease(w http.ResponseWriter, r *http.Request, devices *bridges, sendTimeout time.Duration, deviceName string, event keyEvent, holdMS uint32) {
+	if holdMS > maxHoldMS {
+		writeError(w, http.StatusBadRequest, client.CodeInvalidRequest, fmt.Sprintf("hold_ms must not exceed %d", maxHoldMS))
+		return
+	}
+	target, ok := lookupDevice(w, devices, deviceName)
+	if !ok {
+		return
+	}
+	hold := time.Duration(holdMS) * time.Millisecond
+	sendCtx, cancel := context.WithTimeout(r.Context(), sendTimeout+hold)
+	defer cancel()
+	unlock, ok := acquireDevice(sendCtx, w, target, sendTimeout)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if err := event.pressAndRelease(sendCtx, target.manager, hold); err != nil {
+		writeSendError(w, "send", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pressReleaseResponse{Status: "ok"})
+}
+
+// keyHandler serves `POST /press` and `POST /release`, which send a single
+// packet so keys can be held across requests.
+func keyHandler(devices *bridges, sendTimeout time.Duration, release bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		var req client.KeyRequest
+		if err := decodeJSONBody(r, &req, false); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		event, err := newKeyEvent(req.Type, req.Code, req.Modifiers)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		target, ok := lookupDevice(w, devices, req.Device)
+		if !ok {
+			return
+		}
+		sendCtx, cancel := context.WithTimeout(r.Context(), sendTimeout)
+		defer cancel()
+		unlock, ok := acquireDevice(sendCtx, w, target, sendTimeout)
+		if !ok {
+			return
+		}
+		defer unlock()
+		if err := event.send(sendCtx, target.manager, release); err != nil {
+			writeSendError(w, "send", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(pressReleaseResponse{Status: "ok"})
+	}
+}
+
+// typeStrokes presses and releases each keystroke in order. Each keystroke
+// gets its own send timeout, and all of them together maxTypeDuration.
+func typeStrokes(ctx context.Context, manager *device.Manager, strokes []hid.Keystroke, sendTimeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, maxTypeDuration)
+	defer cancel()
+	for i, stroke := range strokes {
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := manager.PressAndReleaseKeyboard(sendCtx, stroke.Code, stroke.Modifiers, 0, 0)
+		cancel()
+		if err != nil {
+			err = fmt.Errorf("typed %d of %d keystrokes: %w", i, len(strokes), err)
+			if i > 0 {
+				return partlySentError{err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// acquireDevice waits up to sendTimeout for exclusive access to the bridge,
+// writing an error response if it doesn't get it or the bridge isn't
+// connected. Those responses are flagged as not sent.
+func acquireDevice(ctx context.Context, w http.ResponseWriter, target *bridge, sendTimeout time.Duration) (func(), bool) {
+	waitCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	unlock, err := target.acquire(waitCtx)
+	if err != nil {
+		writeNotSentError(w, "send", err)
+		return nil, false
+	}
+	if !target.manager.Status().Connected {
+		unlock()
+		writeNotSentError(w, "send", device.ErrNotConnected)
+		return nil, false
+	}
+	return unlock, true
+}
+
+// lookupDevice resolves the bridge a request targets, writing an error
+// response if it can't.
+func lookupDevice(w http.ResponseWriter, devices *bridges, name string) (*bridge, bool) {
+	target, err := devices.lookup(name)
+	switch {
+	case err == nil:
+		return target, true
+	case errors.Is(err, errUnknownDevice):
+		writeError(w, http.StatusNotFound, client.CodeUnknownDevice, err.Error())
+	default:
+		writeRequestError(w, err)
+	}
+	return nil, false
+}
+
+func decodeEventRequest(r *http.Request) (client.PressAndReleaseRequest, error) {
+	var req client.PressAndReleaseRequest
+	if err := decodeJSONBody(r, &req, false); err != nil {
+		return req, err
+	}
+	if strings.TrimSpace(req.Type) == "" {
+		req.Type = "keyboard"
+	}
+	return req, nil
+}
+
+// decodeJSONBody decodes a single JSON value from the request body,
+// rejecting unknown fields. If allowEmpty is set, an empty body leaves v
+// untouched.
+func decodeJSONBody(r *http.Request, v any, allowEmpty bool) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if allowEmpty && err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("invalid JSON body")
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("invalid JSON body")
+	}
+	return nil
+}
+
+// keyEvent is a validated key request, ready to be sent to a bridge.
+type keyEvent struct {
+	consumer bool
+	code     uint16
+	modifier byte
+	flags    byte
+}
+
+func newKeyEvent(eventType string, code uint16, modifiers *client.PressAndReleaseModifiers) (keyEvent, error) {
+	switch strings.ToLower(strings.TrimSpace(eventType)) {
+	case "", "keyboard":
+		if code > 0xFF {
+			return keyEvent{}, fmt.Errorf("%w: keyboard code must fit in uint8", errCodeOutOfRange)
+		}
+		// code=0 is allowed only for modifier-only keyboard events.
+		if code == 0 && !hasModifiers(modifiers) {
+			return keyEvent{}, fmt.Errorf("missing code")
+		}
+		event := keyEvent{code: code, modifier: modifierMask(modifiers)}
+		if appleFnEnabled(modifiers) {
+			event.flags = device.KeyboardFlagAppleFn
+		}
+		return event, nil
+	case "consumer":
+		if code == 0 {
+			return keyEvent{}, fmt.Errorf("missing code")
+		}
+		return keyEvent{consumer: true, code: code}, nil
+	default:
+		return keyEvent{}, fmt.Errorf("%w: %s", errUnsupportedType, eventType)
+	}
+}
+
+func chordKeyEvent(chord hid.Chord) (keyEvent, error) {
+	if chord.Consumer {
+		if chord.Code == 0 {
+			return keyEvent{}, fmt.Errorf("missing code")
+		}
+		return keyEvent{consumer: true, code: chord.Code}, nil
+	}
+	if chord.Code == 0 && chord.Modifiers == 0 && !chord.AppleFn {
+		return keyEvent{}, fmt.Errorf("missing code")
+	}
+	event := keyEvent{code: chord.Code, modifier: chord.Modifiers}
+	if chord.AppleFn {
+		event.flags = device.KeyboardFlagAppleFn
+	}
+	return event, nil
+}
+
+func (e keyEvent) send(ctx context.Context, manager *device.Manager, release bool) error {
+	if e.consumer {
+		return manager.SendConsumer(ctx, e.code, release)
+	}
+	return manager.SendKeyboard(ctx, e.code, e.modifier, e.flags, release)
+}
+
+func (e keyEvent) pressAndRelease(ctx context.Context, manager *device.Manager, hold time.Duration) error {
+	if e.consumer {
+		return manager.PressAndReleaseConsumer(ctx, e.code, hold)
+	}
+	return manager.PressAndReleaseKeyboard(ctx, e.code, e.modifier, e.flags, hold)
+}
+
+func modifierMask(req *client.PressAndReleaseModifiers) byte {
+	if req == nil {
+		return 0
+	}
+	var mask byte
+	if req.LeftCtrl {
+		mask |= hid.ModLeftCtrl
+	}
+	if req.LeftShift {
+		mask |= hid.ModLeftShift
+	}
+	if req.LeftAlt {
+		mask |= hid.ModLeftAlt
+	}
+	if req.LeftGUI {
+		mask |= hid.ModLeftGUI
+	}
+	if req.RightCtrl {
+		mask |= hid.ModRightCtrl
+	}
+	if req.RightShift {
+		mask |= hid.ModRightShift
+	}
+	if req.RightAlt {
+		mask |= hid.ModRightAlt
+	}
+	if req.RightGUI {
+		mask |= hid.ModRightGUI
+	}
+	return mask
+}
+
+func appleFnEnabled(req *client.PressAndReleaseModifiers) bool {
+	return req != nil && req.AppleFn
+}
+
+func hasModifiers(req *client.PressAndReleaseModifiers) bool {
+	if req == nil {
+		return false
+	}
+	return req.LeftCtrl || req.LeftShift || req.LeftAlt || req.LeftGUI ||
+		req.RightCtrl || req.RightShift || req.RightAlt || req.RightGUI ||
+		req.AppleFn
+}
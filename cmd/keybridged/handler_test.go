@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+	"github.com/2opremio/keybridged/hid"
+)
+
+// newTestHandler serves the API without authentication for a bridge named
+// "test" backed by a connected fake bridge.
+func newTestHandler(t *testing.T) (http.Handler, *devicetest.Bridge) {
+	t.Helper()
+	fake := devicetest.NewBridge(devicetest.Config{})
+	devices := newBridges()
+	t.Cleanup(devices.close)
+	_, err := devices.apply([]deviceSpec{{Name: "test"}}, func(deviceSpec) *device.Manager {
+		return device.NewManager(device.Config{Name: "test", Dialer: fake, Logger: slog.New(slog.DiscardHandler)})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	target, _ := devices.lookup("test")
+	for !target.manager.Status().Connected {
+		select {
+		case <-ctx.Done():
+			t.Fatal("fake bridge didn't connect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	auth := newAuthenticator(authConfig{}, slog.New(slog.DiscardHandler))
+	return newHandler(devices, time.Second, auth), fake
+}
+
+// post sends body to path and returns the response status and body.
+func post(t *testing.T, handler http.Handler, path, body string) (int, string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return recorder.Code, recorder.Body.String()
+}
+
+// errorCode returns the code of a JSON error response body.
+func errorCode(t *testing.T, body string) client.ErrorCode {
+	t.Helper()
+	var resp client.ErrorResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("invalid error response %q: %v", body, err)
+	}
+	return resp.Error.Code
+}
+
+func TestType(t *testing.T) {
+	handler, fake := newTestHandler(t)
+
+	status, body := post(t, handler, "/type", `{"text":"Hi","layout":"de"}`)
+	if status != http.StatusOK {
+		t.Fatalf("POST /type = %d %s", status, body)
+	}
+	want := []device.Packet{
+		{Type: device.PacketKeyboard, Code: hid.KeyA + 'h' - 'a', Modifier: hid.ModLeftShift},
+		{Type: device.PacketKeyboard, Release: true, Code: hid.KeyA + 'h' - 'a', Modifier: hid.ModLeftShift},
+		{Type: device.PacketKeyboard, Code: hid.KeyA + 'i' - 'a'},
+		{Type: device.PacketKeyboard, Release: true, Code: hid.KeyA + 'i' - 'a'},
+	}
+	if got := fake.Packets(); !slices.Equal(got, want) {
+		t.Errorf("packets = %v, want %v", got, want)
+	}
+}
+
+func TestTypeUnsupported(t *testing.T) {
+	handler, fake := newTestHandler(t)
+
+	status, body := post(t, handler, "/type", `{"text":"héllo ñ"}`)
+	if status != http.StatusBadRequest || !strings.Contains(body, `'é', 'ñ'`) {
+		t.Errorf("POST /type = %d %s, want 400 listing the characters", status, body)
+	}
+	if packets := fake.Packets(); len(packets) != 0 {
+		t.Errorf("sent %v for an invalid text", packets)
+	}
+}
+
+func TestTypeStrokesReportsKeystrokes(t *testing.T) {
+	fake := devicetest.NewBridge(devicetest.Config{Unplugged: true})
+	manager := device.NewManager(device.Config{Dialer: fake, Logger: slog.New(slog.DiscardHandler)})
+	defer manager.Close()
+
+	layout, err := hid.LookupLayout("fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strokes, err := layout.Translate("é")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = typeStrokes(t.Context(), manager, append(strokes, strokes...), time.Second)
+	if err == nil || !strings.Contains(err.Error(), "typed 0 of 2 keystrokes") {
+		t.Errorf("typeStrokes = %v, want a keystroke count", err)
+	}
+}
+
+func TestWriteSendErrorNotSent(t *testing.T) {
+	fake := devicetest.NewBridge(devicetest.Config{Unplugged: true})
+	manager := device.NewManager(device.Config{Dialer: fake, Logger: slog.New(slog.DiscardHandler)})
+	defer manager.Close()
+	rejected := manager.SendKeyboard(t.Context(), hid.KeyA, 0, 0, false)
+
+	tests := []struct {
+		name    string
+		err     error
+		notSent bool
+	}{
+		{"rejected before queueing", rejected, true},
+		{"first keystroke", fmt.Errorf("typed 0 of 2 keystrokes: %w", rejected), true},
+		{"later keystroke", partlySentError{fmt.Errorf("typed 1 of 2 keystrokes: %w", rejected)}, false},
+		{"write failure", fmt.Errorf("%w: device write failed: %w", device.ErrNotConnected, io.ErrClosedPipe), false},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		writeSendError(recorder, "send", test.err)
+		var resp client.ErrorResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid error response: %v", test.name, err)
+		}
+		if recorder.Code != http.StatusServiceUnavailable || resp.Error.Code != client.CodeDeviceDisconnected || resp.Error.NotSent != test.notSent {
+			t.Errorf("%s: response = %d %+v, want 503 device_disconnected with not_sent %v", test.name, recorder.Code, resp.Error, test.notSent)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+const defaultUnixSocketMode = 0o660
+
+// unixSocketOptions holds the Unix socket flags.
+type unixSocketOptions struct {
+	path string
+	// mode is the octal file mode of the socket, e.g. "0660".
+	mode string
+	// group owns the socket, by name or numeric ID. Empty keeps the
+	// daemon's group.
+	group string
+}
+
+// listener is a socket the HTTP server is served on.
+type listener struct {
+	net.Listener
+	// tls is set when connections are served with the server's TLS config.
+	tls bool
+}
+
+// listenTCP listens on addr, wrapping connections in TLS if tlsConfig is set.
+func listenTCP(addr string, tlsConfig *tls.Config) (listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return listener{}, err
+	}
+	return listener{Listener: ln, tls: tlsConfig != nil}, nil
+}
+
+// listenUnix listens on the socket path, replacing a stale socket left by a
+// previous run, and applies the configured mode and group. Connections are
+// served over plain HTTP: access is controlled by the file permissions (and
+// tokens, if configured).
+func listenUnix(opts unixSocketOptions) (listener, error) {
+	mode := fs.FileMode(defaultUnixSocketMode)
+	if opts.mode != "" {
+		var err error
+		mode, err = parseSocketMode(opts.mode)
+		if err != nil {
+			return listener{}, err
+		}
+	}
+	gid := -1
+	if opts.group != "" {
+		var err error
+		gid, err = lookupGroup(opts.group)
+		if err != nil {
+			return listener{}, err
+		}
+	}
+
+	if info, err := os.Lstat(opts.path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return listener{}, fmt.Errorf("%s exists and is not a socket", opts.path)
+		}
+		if conn, err := net.Dial("unix", opts.path); err == nil {
+			conn.Close()
+			return listener{}, fmt.Errorf("%s is in use by another process", opts.path)
+		}
+		if err := os.Remove(opts.path); err != nil {
+			return listener{}, fmt.Errorf("remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return listener{}, err
+	}
+
+	// The socket is created private and only then opened up, since it is the
+	// only access control when tokens are off.
+	ln, err := listenUnixPrivate(opts.path)
+	if err != nil {
+		return listener{}, err
+	}
+	if err := os.Chmod(opts.path, mode); err != nil {
+		ln.Close()
+		return listener{}, fmt.Errorf("set socket mode: %w", err)
+	}
+	if gid >= 0 {
+		if err := os.Chown(opts.path, -1, gid); err != nil {
+			ln.Close()
+			return listener{}, fmt.Errorf("set socket group: %w", err)
+		}
+	}
+	return listener{Listener: ln}, nil
+}
+
+func parseSocketMode(value string) (fs.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q (expected octal permissions like 0660)", value)
+	}
+	return fs.FileMode(mode), nil
+}
+
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	entry, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("look up socket group: %w", err)
+	}
+	return strconv.Atoi(entry.Gid)
+}
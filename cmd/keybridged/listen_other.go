@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "net"
+
+// listenUnixPrivate listens on the socket path. There is no umask here, so
+// the socket is only restricted once its configured mode is applied.
+func listenUnixPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
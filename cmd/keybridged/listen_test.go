@@ -0,0 +1,37 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := listenUnix(unixSocketOptions{path: path, mode: "0640"})
+	if err != nil {
+		t.Fatalf("listenUnix: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o640 {
+		t.Errorf("socket mode = %#o, want 0640", mode)
+	}
+	if _, err := listenUnix(unixSocketOptions{path: path}); err == nil {
+		t.Error("listenUnix on a socket in use succeeded")
+	}
+
+	// A socket left by a previous run is replaced.
+	ln.Listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = listenUnix(unixSocketOptions{path: path})
+	if err != nil {
+		t.Fatalf("listenUnix over a stale socket: %v", err)
+	}
+	ln.Close()
+}
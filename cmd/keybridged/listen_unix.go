@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnixPrivate listens on the socket path with the socket created as
+// 0600, so no other user can connect before its configured mode is applied.
+// The umask is process-wide; this only runs at startup, before the bridges
+// and webhooks create any files.
+func listenUnixPrivate(path string) (net.Listener, error) {
+	previous := syscall.Umask(0o177)
+	defer syscall.Umask(previous)
+	return net.Listen("unix", path)
+}
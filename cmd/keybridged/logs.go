@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+)
+
+// logKeepAlive is how often an idle /logs/stream connection gets a comment,
+// so proxies don't time it out.
+const logKeepAlive = 15 * time.Second
+
+// maxLogBacklog bounds the backlog query parameter of /logs/stream.
+const maxLogBacklog = 1000
+
+// logsHandler serves `GET /logs`, returning the device log lines kept in
+// memory, oldest first, merged across bridges unless one is selected.
+func logsHandler(devices *bridges) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w)
+			return
+		}
+		query := r.URL.Query()
+		var since time.Time
+		if value := query.Get("since"); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, client.CodeInvalidRequest, "since must be an RFC 3339 timestamp")
+				return
+			}
+			since = parsed
+		}
+		limit := 0
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, client.CodeInvalidRequest, "limit must be a non-negative integer")
+				return
+			}
+			limit = n
+		}
+		targets := devices.all()
+		if strings.TrimSpace(query.Get("device")) != "" {
+			target, ok := lookupDevice(w, devices, query.Get("device"))
+			if !ok {
+				return
+			}
+			targets = []*bridge{target}
+		}
+		resp := client.LogsResponse{Lines: []client.LogEntry{}}
+		for _, target := range targets {
+			for _, line := range target.manager.RecentLogs(since, limit) {
+				resp.Lines = append(resp.Lines, logEntry(target.name, line))
+			}
+		}
+		sort.SliceStable(resp.Lines, func(i, j int) bool {
+			return resp.Lines[i].Time.Before(resp.Lines[j].Time)
+		})
+		if limit > 0 && len(resp.Lines) > limit {
+			resp.Lines = resp.Lines[len(resp.Lines)-limit:]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func logEntry(name string, line device.LogLine) client.LogEntry {
+	return client.LogEntry{
+		Device:    name,
+		Time:      line.Time,
+		Text:      line.Text,
+		Truncated: line.Truncated,
+	}
+}
+
+// logStreamHandler serves `GET /logs/stream` as Server-Sent Events. Each event
+// carries a client.LogEntry. Without a device, lines from every bridge are
+// streamed.
+func logStreamHandler(devices *bridges) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w)
+			return
+		}
+		query := r.URL.Query()
+		backlog := 0
+		if value := query.Get("backlog"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > maxLogBacklog {
+				writeError(w, http.StatusBadRequest, client.CodeInvalidRequest, fmt.Sprintf("backlog must be between 0 and %d", maxLogBacklog))
+				return
+			}
+			backlog = n
+		}
+		filter := query.Get("filter")
+		targets := devices.all()
+		if strings.TrimSpace(query.Get("device")) != "" {
+			target, ok := lookupDevice(w, devices, query.Get("device"))
+			if !ok {
+				return
+			}
+			targets = []*bridge{target}
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, client.CodeInternal, "streaming unsupported")
+			return
+		}
+
+		// One select case per bridge, plus the request context and keep-alive
+		// ticker.
+		cases := make([]reflect.SelectCase, 0, len(targets)+2)
+		for _, target := range targets {
+			lines, cancel := target.manager.SubscribeLogs(backlog)
+			defer cancel()
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(lines)})
+		}
+		ticker := time.NewTicker(logKeepAlive)
+		defer ticker.Stop()
+		doneCase := len(cases)
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.Context().Done())},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ticker.C)},
+		)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			chosen, value, ok := reflect.Select(cases)
+			switch {
+			case chosen == doneCase:
+				return
+			case chosen == doneCase+1:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case !ok:
+				return
+			default:
+				line := value.Interface().(device.LogLine)
+				if filter != "" && !strings.Contains(line.Text, filter) {
+					continue
+				}
+				payload, err := json.Marshal(logEntry(targets[chosen].name, line))
+				if err != nil {
+					return
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", payload); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
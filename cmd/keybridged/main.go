@@ -2,29 +2,25 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/2opremio/keybridged/client"
 	"github.com/2opremio/keybridged/device"
 )
 
-const (
-	pusbkbKeyboardFlagAppleFn = 0x01
-)
-
 const (
 	defaultHost         = "localhost"
 	defaultPort         = 9876
@@ -32,195 +28,366 @@ const (
 )
 
 func main() {
+	configPath := flag.String("config", "", "JSON configuration file, reloaded on SIGHUP (cannot be combined with other flags)")
 	host := flag.String("host", defaultHost, "Host to bind the HTTP server to")
-	port := flag.Int("port", defaultPort, "Port to bind the HTTP server to")
+	port := flag.Int("port", defaultPort, "Port to bind the HTTP server to (0 to only listen on -unix-socket)")
 	sendTimeoutSeconds := flag.Int("send-timeout", defaultSendTimeoutS, "Seconds to wait when queueing an event")
 	vidFlag := flag.String("vid", fmt.Sprintf("0x%04X", device.DefaultVID), "USB VID of the serial adapter (hex)")
 	pidFlag := flag.String("pid", fmt.Sprintf("0x%04X", device.DefaultPID), "USB PID of the serial adapter (hex)")
+	pathFlag := flag.String("path", "", "Serial device path to open instead of discovering it by VID/PID")
+	serialFlag := flag.String("serial", "", "USB serial number of the serial adapter (narrows VID/PID discovery)")
+	productFlag := flag.String("product", "", "Substring of the USB product string of the serial adapter (narrows VID/PID discovery)")
+	baudFlag := flag.Int("baud", device.DefaultBaudRate, "Baud rate of the serial port")
+	dataBitsFlag := flag.Int("data-bits", device.DefaultDataBits, "Data bits of the serial port (5 to 8)")
+	parityFlag := flag.String("parity", "none", "Parity of the serial port: none, odd, even, mark or space")
+	stopBitsFlag := flag.String("stop-bits", "1", "Stop bits of the serial port: 1, 1.5 or 2")
+	dtrFlag := flag.Bool("dtr", true, "Assert DTR once the serial port is open")
+	rtsFlag := flag.Bool("rts", true, "Assert RTS once the serial port is open")
+	pulseFlag := flag.Duration("pulse", 0, "Hold DTR and RTS inverted for this long after opening the serial port, to reset the bridge (0 disables)")
+	logBacklog := flag.Int("log-backlog", device.DefaultLogBacklog, "Number of recent device log lines kept in memory per bridge for /logs")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	var deviceSpecs deviceFlags
+	tokenFile := flag.String("token-file", "", "File of name:token lines; requests must then send one of the tokens as a bearer token (also read from "+tokensEnv+")")
+	var unixOpts unixSocketOptions
+	flag.StringVar(&unixOpts.path, "unix-socket", "", "Path of a Unix socket to serve the HTTP API on, alongside -host/-port")
+	flag.StringVar(&unixOpts.mode, "unix-socket-mode", fmt.Sprintf("%04o", defaultUnixSocketMode), "File mode of -unix-socket (octal)")
+	flag.StringVar(&unixOpts.group, "unix-socket-group", "", "Group owning -unix-socket, by name or ID (default: the daemon's group)")
+	var tlsOpts tlsOptions
+	flag.StringVar(&tlsOpts.certFile, "tls-cert", "", "PEM certificate to serve HTTPS with (requires -tls-key)")
+	flag.StringVar(&tlsOpts.keyFile, "tls-key", "", "PEM private key for -tls-cert")
+	flag.StringVar(&tlsOpts.clientCAFile, "tls-client-ca", "", "PEM CA bundle; clients presenting a certificate signed by it are authenticated (mTLS)")
+	flag.StringVar(&tlsOpts.clientNamesFile, "tls-client-names", "", "File of name:common-name lines mapping client certificates to client names; unlisted certificates are rejected")
+	var webhookURLs webhookFlags
+	flag.Var(&webhookURLs, "webhook", "URL to POST device state changes (found, lost, connected, disconnected) to as JSON (repeatable)")
+	flag.Var(&deviceSpecs, "device", "Named bridge as name=<name>,vid=<hex>,pid=<hex>,path=<path>,serial=<serial>,product=<product>,baud=<rate>,databits=<bits>,parity=<parity>,stopbits=<bits>,dtr=on|off,rts=on|off,pulse=<duration> (repeatable; overrides the selector and serial port flags)")
 	flag.Parse()
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
-	slog.SetDefault(logger)
+	// load returns the configuration, re-reading the -config file on reload.
+	var load func() (daemonConfig, error)
+	if *configPath != "" {
+		var others []string
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name != "config" {
+				others = append(others, "-"+f.Name)
+			}
+		})
+		if len(others) > 0 {
+			slog.Error("-config cannot be combined with other flags", "flags", strings.Join(others, " "))
+			os.Exit(1)
+		}
+		load = func() (daemonConfig, error) {
+			return loadConfigFile(*configPath)
+		}
+	} else {
+		config := defaultConfig()
+		config.Host = *host
+		config.Port = *port
+		config.Unix = unixOpts
+		config.TLS = tlsOpts
+		config.TokenFile = strings.TrimSpace(*tokenFile)
+		config.SendTimeout = time.Duration(*sendTimeoutSeconds) * time.Second
+		config.LogBacklog = *logBacklog
+		config.LogFormat = *logFormat
+		config.Webhooks = webhookURLs
+		if err := config.LogLevel.UnmarshalText([]byte(*logLevel)); err != nil {
+			slog.Error("invalid -log-level", "value", *logLevel)
+			os.Exit(1)
+		}
+		if config.LogFormat != "text" && config.LogFormat != "json" {
+			slog.Error("invalid -log-format", "value", *logFormat)
+			os.Exit(1)
+		}
+		vid, err := parseUSBID(*vidFlag)
+		if err != nil {
+			slog.Error("invalid VID", "value", *vidFlag, "error", err)
+			os.Exit(1)
+		}
+		pid, err := parseUSBID(*pidFlag)
+		if err != nil {
+			slog.Error("invalid PID", "value", *pidFlag, "error", err)
+			os.Exit(1)
+		}
+		selector := device.Selector{
+			VID:          vid,
+			PID:          pid,
+			Path:         strings.TrimSpace(*pathFlag),
+			SerialNumber: strings.TrimSpace(*serialFlag),
+			Product:      strings.TrimSpace(*productFlag),
+		}
+		if err := selector.Validate(); err != nil {
+			slog.Error("invalid device selector", "error", err)
+			os.Exit(1)
+		}
+		serialMode := device.SerialMode{
+			BaudRate: *baudFlag,
+			DataBits: *dataBitsFlag,
+			Pulse:    *pulseFlag,
+		}
+		if serialMode.Parity, err = device.ParseParity(*parityFlag); err != nil {
+			slog.Error("invalid -parity", "error", err)
+			os.Exit(1)
+		}
+		if serialMode.StopBits, err = device.ParseStopBits(*stopBitsFlag); err != nil {
+			slog.Error("invalid -stop-bits", "error", err)
+			os.Exit(1)
+		}
+		if !*dtrFlag {
+			serialMode.DTR = device.LineOff
+		}
+		if !*rtsFlag {
+			serialMode.RTS = device.LineOff
+		}
+		if err := serialMode.Validate(); err != nil {
+			slog.Error("invalid serial port settings", "error", err)
+			os.Exit(1)
+		}
+		config.Devices = deviceSpecs
+		if len(config.Devices) == 0 {
+			config.Devices = []deviceSpec{{Name: defaultDeviceName, Selector: selector, Serial: serialMode}}
+		}
+		load = func() (daemonConfig, error) {
+			return config, nil
+		}
+	}
 
-	vid, err := parseUSBID(*vidFlag)
+	config, err := load()
 	if err != nil {
-		logger.Error("invalid VID", "value", *vidFlag, "error", err)
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	d := &daemon{load: load, config: config}
+	d.level.Set(config.LogLevel)
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: &d.level})
+	if config.LogFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &d.level})
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	d.logger = logger
+
+	if config.TLS.clientCAFile != "" && !config.TLS.enabled() {
+		logger.Error("invalid TLS configuration", "error", "-tls-client-ca requires -tls-cert and -tls-key")
 		os.Exit(1)
 	}
-	pid, err := parseUSBID(*pidFlag)
+	if config.TLS.clientNamesFile != "" && config.TLS.clientCAFile == "" {
+		logger.Error("invalid TLS configuration", "error", "-tls-client-names requires -tls-client-ca")
+		os.Exit(1)
+	}
+	var tlsConfig *tls.Config
+	if config.TLS.enabled() {
+		tlsConfig, err = config.TLS.serverConfig()
+		if err != nil {
+			logger.Error("invalid TLS configuration", "error", err)
+			os.Exit(1)
+		}
+		d.clientCerts = tlsConfig.ClientCAs != nil
+	}
+	auth, err := loadAuth(config, d.clientCerts)
 	if err != nil {
-		logger.Error("invalid PID", "value", *pidFlag, "error", err)
+		logger.Error("invalid authentication configuration", "error", err)
 		os.Exit(1)
 	}
-	logger.Info("looking for USB serial adapter", "vid", fmt.Sprintf("0x%04X", vid), "pid", fmt.Sprintf("0x%04X", pid))
+	d.auth = newAuthenticator(auth, logger)
 
-	manager := device.NewManager(device.Config{
-		Logger: logger,
-		VID:    vid,
-		PID:    pid,
-	})
-	defer manager.Close()
+	listeners, err := activatedListeners(tlsConfig)
+	if err != nil {
+		logger.Error("listen failed", "error", err)
+		os.Exit(1)
+	}
+	// Without socket activation, TCP and the Unix socket are opened
+	// independently.
+	activated := len(listeners) > 0
+	if activated {
+		logger.Info("using socket-activated listeners, ignoring -host, -port and -unix-socket", "count", len(listeners))
+	} else if config.Port == 0 && config.Unix.path == "" {
+		logger.Error("-port 0 requires -unix-socket")
+		os.Exit(1)
+	} else if !auth.enabled() && config.Port != 0 && !isLoopbackHost(config.Host) {
+		logger.Warn("serving without authentication on a non-loopback address, set -token-file or "+tokensEnv, "host", config.Host)
+	}
+	if !activated && config.Port != 0 {
+		ln, err := listenTCP(net.JoinHostPort(config.Host, strconv.Itoa(config.Port)), tlsConfig)
+		if err != nil {
+			logger.Error("listen failed", "error", err)
+			os.Exit(1)
+		}
+		listeners = append(listeners, ln)
+	}
+	if !activated && config.Unix.path != "" {
+		ln, err := listenUnix(config.Unix)
+		if err != nil {
+			logger.Error("listen failed", "socket", config.Unix.path, "error", err)
+			os.Exit(1)
+		}
+		listeners = append(listeners, ln)
+	}
 
-	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
-	server := &http.Server{
-		Addr:              addr,
-		Handler:           newHandler(manager, time.Duration(*sendTimeoutSeconds)*time.Second),
-		ReadHeaderTimeout: 5 * time.Second,
+	d.webhooks.Store(newWebhooks(config.Webhooks, logger))
+	defer func() { d.webhooks.Load().close() }()
+	d.systemd = newSystemdStatus(nil, logger)
+	d.devices = newBridges()
+	defer d.devices.close()
+	if _, err := d.devices.apply(config.Devices, d.startDevice); err != nil {
+		logger.Error("invalid device configuration", "error", err)
+		os.Exit(1)
 	}
+	d.systemd.setNames(d.devices.names(), nil)
+
+	server := newServer(newHandler(d.devices, config.SendTimeout, d.auth), tlsConfig)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
 
-	errCh := make(chan error, 1)
-	go func() {
-		logger.Info("keybridge server listening", "addr", addr)
-		errCh <- server.ListenAndServe()
-	}()
-
-	select {
-	case <-ctx.Done():
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		logger.Info("shutting down")
-		if err := server.Shutdown(shutdownCtx); err != nil {
-			logger.Error("shutdown error", "error", err)
-		}
-	case err := <-errCh:
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Error("server error", "error", err)
-			os.Exit(1)
+	errCh := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func() {
+			addr := ln.Addr().String()
+			if ln.tls {
+				logger.Info("keybridge server listening", "addr", addr, "tls", true, "mtls", d.clientCerts)
+				errCh <- server.ServeTLS(ln, "", "")
+				return
+			}
+			logger.Info("keybridge server listening", "addr", addr)
+			errCh <- server.Serve(ln)
+		}()
+	}
+	d.systemd.send("READY=1\nSTATUS=" + d.systemd.status())
+	go d.systemd.watchdog(d.devices, ctx.Done())
+
+	for {
+		select {
+		case <-hangup:
+			d.reload()
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			logger.Info("shutting down")
+			d.systemd.send("STOPPING=1")
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.Error("shutdown error", "error", err)
+			}
+			return
+		case err := <-errCh:
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("server error", "error", err)
+				os.Exit(1)
+			}
+			return
 		}
 	}
 }
 
-func parseUSBID(value string) (uint16, error) {
-	parsed, err := strconv.ParseUint(strings.TrimSpace(value), 0, 16)
-	if err != nil {
-		return 0, err
+// newServer returns the HTTP server for handler. Shutting it down cancels
+// the context of requests in flight, so that /logs/stream and /ws sessions
+// end rather than holding up the shutdown.
+func newServer(handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
 	}
-	return uint16(parsed), nil
+	server.RegisterOnShutdown(cancel)
+	return server
 }
 
-type pressReleaseResponse struct {
-	Status string `json:"status"`
+// daemon holds the state that a configuration reload updates.
+type daemon struct {
+	load        func() (daemonConfig, error)
+	config      daemonConfig
+	logger      *slog.Logger
+	level       slog.LevelVar
+	clientCerts bool
+	auth        *authenticator
+	webhooks    atomic.Pointer[webhooks]
+	systemd     *systemdStatus
+	devices     *bridges
 }
 
-func newHandler(manager *device.Manager, sendTimeout time.Duration) http.Handler {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/pressandrelease", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		req, err := decodeEventRequest(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		// code=0 is allowed only for modifier-only keyboard events.
-		if req.Code == 0 && (strings.TrimSpace(req.Type) != "" && strings.ToLower(strings.TrimSpace(req.Type)) != "keyboard") {
-			http.Error(w, "missing code", http.StatusBadRequest)
-			return
-		}
-		if req.Code == 0 && !hasModifiers(req.Modifiers) {
-			http.Error(w, "missing code", http.StatusBadRequest)
-			return
-		}
-		sendCtx, cancel := context.WithTimeout(r.Context(), sendTimeout)
-		defer cancel()
-		if err := sendEvent(sendCtx, manager, req); err != nil {
-			http.Error(w, fmt.Sprintf("send failed: %v", err), http.StatusServiceUnavailable)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(pressReleaseResponse{Status: "ok"})
+func (d *daemon) startDevice(spec deviceSpec) *device.Manager {
+	d.logger.Info("looking for USB serial adapter", "device", spec.Name, "selector", spec.Selector.String(), "serial", spec.Serial.String())
+	return device.NewManager(device.Config{
+		Logger:        d.logger,
+		Name:          spec.Name,
+		Selector:      spec.Selector,
+		Serial:        spec.Serial,
+		LogBacklog:    d.config.LogBacklog,
+		OnStateChange: d.onStateChange,
 	})
-
-	return mux
 }
 
-func decodeEventRequest(r *http.Request) (client.PressAndReleaseRequest, error) {
-	var req client.PressAndReleaseRequest
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	if err := decoder.Decode(&req); err != nil {
-		return req, fmt.Errorf("invalid JSON body")
-	}
-	if err := decoder.Decode(&struct{}{}); err != io.EOF {
-		return req, fmt.Errorf("invalid JSON body")
-	}
-	if strings.TrimSpace(req.Type) == "" {
-		req.Type = "keyboard"
-	}
-	return req, nil
+func (d *daemon) onStateChange(change device.StateChange) {
+	d.webhooks.Load().notify(change)
+	d.systemd.notify(change)
 }
 
-func sendEvent(ctx context.Context, manager *device.Manager, req client.PressAndReleaseRequest) error {
-	switch strings.ToLower(strings.TrimSpace(req.Type)) {
-	case "keyboard":
-		if req.Code > 0xFF {
-			return fmt.Errorf("keyboard code must fit in uint8")
-		}
-		modifier := modifierMask(req.Modifiers)
-		flags := byte(0)
-		if appleFnEnabled(req.Modifiers) {
-			flags = pusbkbKeyboardFlagAppleFn
-		}
-		if err := manager.SendKeyboard(ctx, req.Code, modifier, flags, false); err != nil {
-			return err
-		}
-		return manager.SendKeyboard(ctx, req.Code, modifier, flags, true)
-	case "consumer":
-		if err := manager.SendConsumer(ctx, req.Code, false); err != nil {
-			return err
-		}
-		return manager.SendConsumer(ctx, req.Code, true)
-	default:
-		return fmt.Errorf("invalid type: %s", req.Type)
-	}
-}
+// reload re-reads the configuration. Devices whose settings changed are
+// restarted, and tokens, client certificate names, the log level and
+// webhooks are replaced. Other changes need a restart. If the new
+// configuration is invalid, the current one is kept.
+func (d *daemon) reload() {
+	d.logger.Info("reloading configuration")
+	d.systemd.send("RELOADING=1")
+	defer func() { d.systemd.send("READY=1\nSTATUS=" + d.systemd.status()) }()
 
-func modifierMask(req *client.PressAndReleaseModifiers) byte {
-	if req == nil {
-		return 0
-	}
-	var mask byte
-	if req.LeftCtrl {
-		mask |= 0x01
-	}
-	if req.LeftShift {
-		mask |= 0x02
-	}
-	if req.LeftAlt {
-		mask |= 0x04
+	config, err := d.load()
+	if err != nil {
+		d.logger.Error("configuration reload failed, keeping the current configuration", "error", err)
+		return
 	}
-	if req.LeftGUI {
-		mask |= 0x08
+	auth, err := loadAuth(config, d.clientCerts)
+	if err == nil {
+		err = validateSpecs(config.Devices)
 	}
-	if req.RightCtrl {
-		mask |= 0x10
+	if err != nil {
+		d.logger.Error("configuration reload failed, keeping the current configuration", "error", err)
+		return
 	}
-	if req.RightShift {
-		mask |= 0x20
+	// Nothing below fails, so the new configuration is applied as a whole.
+	if keys := d.config.restartRequired(config); len(keys) > 0 {
+		d.logger.Warn("configuration changes need a restart to take effect", "keys", strings.Join(keys, ", "))
 	}
-	if req.RightAlt {
-		mask |= 0x40
+	d.auth.set(auth)
+	d.level.Set(config.LogLevel)
+	if !slices.Equal(d.config.Webhooks, config.Webhooks) {
+		previous := d.webhooks.Swap(newWebhooks(config.Webhooks, d.logger))
+		go previous.close()
 	}
-	if req.RightGUI {
-		mask |= 0x80
+	changed, err := d.devices.apply(config.Devices, d.startDevice)
+	if err != nil {
+		// Unreachable: the specs passed validateSpecs.
+		d.logger.Error("device reload failed", "error", err)
 	}
-	return mask
+	d.systemd.setNames(d.devices.names(), changed)
+
+	// Settings that need a restart keep their current values.
+	kept := d.config
+	kept.TokenFile = config.TokenFile
+	kept.TLS.clientNamesFile = config.TLS.clientNamesFile
+	kept.LogLevel = config.LogLevel
+	kept.Webhooks = config.Webhooks
+	kept.Devices = config.Devices
+	d.config = kept
+	d.logger.Info("configuration reloaded", "restarted_devices", strings.Join(changed, ", "))
 }
 
-func appleFnEnabled(req *client.PressAndReleaseModifiers) bool {
-	return req != nil && req.AppleFn
+func parseUSBID(value string) (uint16, error) {
+	parsed, err := strconv.ParseUint(strings.TrimSpace(value), 0, 16)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(parsed), nil
 }
 
-func hasModifiers(req *client.PressAndReleaseModifiers) bool {
-	if req == nil {
-		return false
+// isLoopbackHost reports whether host only accepts local connections.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
 	}
-	return req.LeftCtrl || req.LeftShift || req.LeftAlt || req.LeftGUI ||
-		req.RightCtrl || req.RightShift || req.RightAlt || req.RightGUI ||
-		req.AppleFn
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
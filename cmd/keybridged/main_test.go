@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+func TestShutdownEndsLogStreams(t *testing.T) {
+	handler, _ := newTestHandler(t)
+	server := newServer(handler, nil)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(ln) }()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/logs/stream")
+	if err != nil {
+		t.Fatalf("GET /logs/stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /logs/stream = %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown with an open log stream: %v", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve = %v, want ErrServerClosed", err)
+	}
+}
+
+// An invalid device list leaves every setting of the running configuration
+// in place, including those validated earlier.
+func TestReloadKeepsConfigurationOnInvalidDevices(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokenFile, []byte("laptop:secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(tokensEnv, "")
+	current := defaultConfig()
+	current.Devices = []deviceSpec{{Name: "ipad"}}
+	next := current
+	next.TokenFile = tokenFile
+	next.LogLevel = slog.LevelDebug
+	next.Webhooks = []string{"http://127.0.0.1:1/hook"}
+	next.Devices = []deviceSpec{{Name: "ipad"}, {Name: "mac", Serial: device.SerialMode{DataBits: 9}}}
+
+	logger := slog.New(slog.DiscardHandler)
+	d := &daemon{
+		load:    func() (daemonConfig, error) { return next, nil },
+		config:  current,
+		logger:  logger,
+		auth:    newAuthenticator(authConfig{}, logger),
+		systemd: newSystemdStatus(nil, logger),
+		devices: newBridges(),
+	}
+	defer d.devices.close()
+	d.webhooks.Store(newWebhooks(nil, logger))
+	defer func() { d.webhooks.Load().close() }()
+	start := func(spec deviceSpec) *device.Manager {
+		return device.NewManager(device.Config{Name: spec.Name, Dialer: devicetest.NewBridge(devicetest.Config{Unplugged: true}), Logger: logger})
+	}
+	if _, err := d.devices.apply(current.Devices, start); err != nil {
+		t.Fatal(err)
+	}
+
+	d.reload()
+	if d.auth.config.Load().enabled() {
+		t.Error("reload enabled authentication from an invalid configuration")
+	}
+	if d.level.Level() != slog.LevelInfo {
+		t.Errorf("log level = %s, want %s", d.level.Level(), slog.LevelInfo)
+	}
+	if targets := d.webhooks.Load().targets; len(targets) != 0 {
+		t.Errorf("reload replaced the webhooks with %d targets", len(targets))
+	}
+	if names := d.devices.names(); len(names) != 1 {
+		t.Errorf("devices = %q, want only ipad", names)
+	}
+}
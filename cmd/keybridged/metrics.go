@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/2opremio/keybridged/device"
+)
+
+// packetTypes lists the packet types reported by /metrics, so their series
+// exist before the first packet is sent.
+var packetTypes = []device.PacketType{device.PacketKeyboard, device.PacketConsumer}
+
+// httpMetrics counts HTTP requests by status code.
+type httpMetrics struct {
+	mu       sync.Mutex
+	requests map[int]uint64
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{requests: make(map[int]uint64)}
+}
+
+// wrap counts the requests served by next.
+func (h *httpMetrics) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		h.mu.Lock()
+		h.requests[status]++
+		h.mu.Unlock()
+	})
+}
+
+func (h *httpMetrics) snapshot() map[int]uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	requests := make(map[int]uint64, len(h.requests))
+	for status, count := range h.requests {
+		requests[status] = count
+	}
+	return requests
+}
+
+// statusRecorder captures the status code written by a handler. It passes
+// through Flush and Hijack for /logs/stream and /ws.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// metricsHandler serves `GET /metrics` in the Prometheus text exposition
+// format.
+func metricsHandler(devices *bridges, requests *httpMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w)
+			return
+		}
+		list := devices.all()
+		stats := make([]device.Stats, len(list))
+		for i, entry := range list {
+			stats[i] = entry.manager.Stats()
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, list, stats, requests.snapshot())
+	}
+}
+
+func writeMetrics(w io.Writer, list []*bridge, stats []device.Stats, requests map[int]uint64) {
+	byType := func(name, help string, counts func(device.Stats) map[device.PacketType]uint64) {
+		writeHeader(w, name, "counter", help)
+		for i, entry := range list {
+			for _, packetType := range packetTypes {
+				fmt.Fprintf(w, "%s{device=%s,type=%s} %d\n", name, quote(entry.name), quote(packetType.String()), counts(stats[i])[packetType])
+			}
+		}
+	}
+	perDevice := func(name, kind, help string, value func(device.Stats) string) {
+		writeHeader(w, name, kind, help)
+		for i, entry := range list {
+			fmt.Fprintf(w, "%s{device=%s} %s\n", name, quote(entry.name), value(stats[i]))
+		}
+	}
+	counter := func(value func(device.Stats) uint64) func(device.Stats) string {
+		return func(s device.Stats) string { return strconv.FormatUint(value(s), 10) }
+	}
+
+	byType("keybridge_packets_enqueued_total", "Packets queued for writing to the bridge.",
+		func(s device.Stats) map[device.PacketType]uint64 { return s.Enqueued })
+	byType("keybridge_packets_written_total", "Packets written to the bridge.",
+		func(s device.Stats) map[device.PacketType]uint64 { return s.Written })
+	byType("keybridge_packets_dropped_total", "Packets not written because the bridge was disconnected, the send was canceled or the daemon was closing.",
+		func(s device.Stats) map[device.PacketType]uint64 { return s.Dropped })
+	perDevice("keybridge_write_errors_total", "counter", "Failed writes to the serial port.",
+		counter(func(s device.Stats) uint64 { return s.WriteErrors }))
+	perDevice("keybridge_connects_total", "counter", "Connections established to the bridge.",
+		counter(func(s device.Stats) uint64 { return s.Connects }))
+	perDevice("keybridge_open_failures_total", "counter", "Failed attempts to open the serial port.",
+		counter(func(s device.Stats) uint64 { return s.OpenFailures }))
+	perDevice("keybridge_device_log_lines_total", "counter", "Log lines read from the bridge firmware.",
+		counter(func(s device.Stats) uint64 { return s.LogLines }))
+	perDevice("keybridge_device_log_truncations_total", "counter", "Device log lines split because they were too long.",
+		counter(func(s device.Stats) uint64 { return s.LogTruncations }))
+	perDevice("keybridge_connected", "gauge", "Whether the bridge is connected (1) or not (0).",
+		func(s device.Stats) string {
+			if s.Connected {
+				return "1"
+			}
+			return "0"
+		})
+	perDevice("keybridge_queue_depth", "gauge", "Packets waiting to be written to the bridge.",
+		func(s device.Stats) string { return strconv.Itoa(s.QueueDepth) })
+
+	const latency = "keybridge_write_latency_seconds"
+	writeHeader(w, latency, "histogram", "Time from queueing a packet until it has been written to the bridge.")
+	for i, entry := range list {
+		hist := stats[i].WriteLatency
+		name := quote(entry.name)
+		for j, bound := range hist.Buckets {
+			fmt.Fprintf(w, "%s_bucket{device=%s,le=%s} %d\n", latency, name, quote(formatFloat(bound)), hist.Counts[j])
+		}
+		fmt.Fprintf(w, "%s_bucket{device=%s,le=\"+Inf\"} %d\n", latency, name, hist.Count)
+		fmt.Fprintf(w, "%s_sum{device=%s} %s\n", latency, name, formatFloat(hist.Sum))
+		fmt.Fprintf(w, "%s_count{device=%s} %d\n", latency, name, hist.Count)
+	}
+
+	const httpRequests = "keybridge_http_requests_total"
+	writeHeader(w, httpRequests, "counter", "HTTP requests served, by status code.")
+	codes := make([]int, 0, len(requests))
+	for code := range requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s{code=\"%d\"} %d\n", httpRequests, code, requests[code])
+	}
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// quote formats a label value.
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
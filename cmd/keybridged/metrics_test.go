@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsCountUnauthorizedRequests(t *testing.T) {
+	auth := newAuthenticator(authConfig{
+		tokens: tokens{{name: "test", hash: sha256.Sum256([]byte("secret"))}},
+	}, slog.New(slog.DiscardHandler))
+	handler := newHandler(newBridges(), time.Second, auth)
+
+	for _, path := range []string{"/status", "/devices"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("GET %s without a token = %d, want 401", path, recorder.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	body, _ := io.ReadAll(recorder.Body)
+	if want := `keybridge_http_requests_total{code="401"} 2`; !strings.Contains(string(body), want) {
+		t.Errorf("metrics missing %q:\n%s", want, body)
+	}
+}
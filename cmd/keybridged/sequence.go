@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/hid"
+)
+
+// maxSequenceSteps bounds the number of steps accepted by /sequence.
+const maxSequenceSteps = 256
+
+// maxSequenceDuration bounds how long a sequence may hold the bridge,
+// including its holds and delays.
+const maxSequenceDuration = 2 * time.Minute
+
+// sequenceOp is a validated sequence step.
+type sequenceOp struct {
+	action string
+	// event is the key sent by press and release steps.
+	event *keyEvent
+	// wait is the time the step spends holding a key or delaying.
+	wait time.Duration
+	run  func(ctx context.Context, manager *device.Manager, sendTimeout time.Duration) error
+}
+
+func sequenceHandler(devices *bridges, sendTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		var req client.SequenceRequest
+		if err := decodeJSONBody(r, &req, false); err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		ops, err := planSequence(req.Steps)
+		if err != nil {
+			writeRequestError(w, err)
+			return
+		}
+		target, ok := lookupDevice(w, devices, req.Device)
+		if !ok {
+			return
+		}
+		unlock, ok := acquireDevice(r.Context(), w, target, sendTimeout)
+		if !ok {
+			return
+		}
+		defer unlock()
+
+		resp := runSequence(r.Context(), target.manager, ops, sendTimeout)
+		status := http.StatusOK
+		if resp.Status != client.StepOK {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// runSequence executes ops in order, stopping at the first failure or after
+// maxSequenceDuration. After a failure, every held key is released.
+func runSequence(ctx context.Context, manager *device.Manager, ops []sequenceOp, sendTimeout time.Duration) client.SequenceResponse {
+	ctx, cancel := context.WithTimeout(ctx, maxSequenceDuration)
+	defer cancel()
+	resp := client.SequenceResponse{Status: client.StepOK, Steps: make([]client.SequenceStepResult, len(ops))}
+	for i, op := range ops {
+		resp.Steps[i].Action = op.action
+		if resp.Status != client.StepOK {
+			resp.Steps[i].Status = client.StepSkipped
+			continue
+		}
+		if err := op.run(ctx, manager, sendTimeout); err != nil {
+			resp.Status = client.StepFailed
+			resp.Steps[i].Status = client.StepFailed
+			resp.Steps[i].Error = err.Error()
+			resp.Steps[i].Code = sendErrorCode(err)
+			continue
+		}
+		resp.Steps[i].Status = client.StepOK
+	}
+	if resp.Status != client.StepOK {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		_ = manager.ReleaseAll(releaseCtx)
+	}
+	return resp
+}
+
+// planSequence validates every step before anything is sent.
+func planSequence(steps []client.SequenceStep) ([]sequenceOp, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("missing steps")
+	}
+	if len(steps) > maxSequenceSteps {
+		return nil, fmt.Errorf("sequence must not exceed %d steps", maxSequenceSteps)
+	}
+	ops := make([]sequenceOp, 0, len(steps))
+	var wait time.Duration
+	for i, step := range steps {
+		op, err := planStep(step)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i, err)
+		}
+		wait += op.wait
+		ops = append(ops, op)
+	}
+	if wait > maxSequenceDuration {
+		return nil, fmt.Errorf("holds and delays add up to %s, more than the %s a sequence may take", wait, maxSequenceDuration)
+	}
+	return ops, nil
+}
+
+func planStep(step client.SequenceStep) (sequenceOp, error) {
+	action := strings.ToLower(strings.TrimSpace(step.Action))
+	op := sequenceOp{action: action}
+	switch action {
+	case client.ActionPress, client.ActionRelease:
+		event, err := stepKeyEvent(step)
+		if err != nil {
+			return op, err
+		}
+		release := action == client.ActionRelease
+		op.event = &event
+		op.run = func(ctx context.Context, manager *device.Manager, sendTimeout time.Duration) error {
+			sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+			defer cancel()
+			return event.send(sendCtx, manager, release)
+		}
+	case client.ActionPressAndRelease, client.ActionConsumer:
+		if action == client.ActionConsumer {
+			step.Type = "consumer"
+		}
+		event, err := stepKeyEvent(step)
+		if err != nil {
+			return op, err
+		}
+		if step.HoldMS > maxHoldMS {
+			return op, fmt.Errorf("hold_ms must not exceed %d", maxHoldMS)
+		}
+		hold := time.Duration(step.HoldMS) * time.Millisecond
+		op.wait = hold
+		op.run = func(ctx context.Context, manager *device.Manager, sendTimeout time.Duration) error {
+			sendCtx, cancel := context.WithTimeout(ctx, sendTimeout+hold)
+			defer cancel()
+			return event.pressAndRelease(sendCtx, manager, hold)
+		}
+	case client.ActionType:
+		layout, err := hid.LookupLayout(step.Layout)
+		if err != nil {
+			return op, err
+		}
+		if step.Text == "" {
+			return op, fmt.Errorf("missing text")
+		}
+		strokes, err := layout.Translate(step.Text)
+		if err != nil {
+			return op, err
+		}
+		op.run = func(ctx context.Context, manager *device.Manager, sendTimeout time.Duration) error {
+			return typeStrokes(ctx, manager, strokes, sendTimeout)
+		}
+	case client.ActionDelay:
+		if step.DelayMS > maxHoldMS {
+			return op, fmt.Errorf("delay_ms must not exceed %d", maxHoldMS)
+		}
+		delay := time.Duration(step.DelayMS) * time.Millisecond
+		op.wait = delay
+		op.run = func(ctx context.Context, _ *device.Manager, _ time.Duration) error {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return nil
+			case <-ctx.Done():
+				return fmt.Errorf("delay canceled: %w", ctx.Err())
+			}
+		}
+	default:
+		return op, fmt.Errorf("invalid action: %q", step.Action)
+	}
+	return op, nil
+}
+
+// stepKeyEvent builds the event of a key step from either Keys or
+// Type/Code/Modifiers.
+func stepKeyEvent(step client.SequenceStep) (keyEvent, error) {
+	if step.Keys == "" {
+		return newKeyEvent(step.Type, step.Code, step.Modifiers)
+	}
+	if step.Code != 0 || step.Modifiers != nil {
+		return keyEvent{}, fmt.Errorf("keys cannot be combined with code or modifiers")
+	}
+	chord, err := hid.ParseChord(step.Keys)
+	if err != nil {
+		return keyEvent{}, err
+	}
+	if step.Type == "consumer" && !chord.Consumer {
+		return keyEvent{}, fmt.Errorf("consumer steps need a media: key")
+	}
+	return chordKeyEvent(chord)
+}
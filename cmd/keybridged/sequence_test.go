@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/hid"
+)
+
+// stepStatuses returns the overall and per-step statuses of a /sequence
+// response body.
+func stepStatuses(t *testing.T, body string) (string, []string, client.SequenceResponse) {
+	t.Helper()
+	var resp client.SequenceResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("invalid sequence response %q: %v", body, err)
+	}
+	statuses := make([]string, 0, len(resp.Steps))
+	for _, step := range resp.Steps {
+		statuses = append(statuses, step.Status)
+	}
+	return resp.Status, statuses, resp
+}
+
+func TestSequence(t *testing.T) {
+	handler, fake := newTestHandler(t)
+
+	status, body := post(t, handler, "/sequence", `{"steps":[
+		{"action":"press","keys":"shift"},
+		{"action":"pressandrelease","keys":"a"},
+		{"action":"release","keys":"shift"},
+		{"action":"delay","delay_ms":1},
+		{"action":"type","text":"z","layout":"de"},
+		{"action":"consumer","keys":"media:playpause"}
+	]}`)
+	if status != http.StatusOK {
+		t.Fatalf("POST /sequence = %d %s", status, body)
+	}
+	overall, statuses, _ := stepStatuses(t, body)
+	if overall != client.StepOK || len(statuses) != 6 || slices.ContainsFunc(statuses, func(s string) bool { return s != client.StepOK }) {
+		t.Errorf("statuses = %s %v, want ok for all 6 steps", overall, statuses)
+	}
+	keyY := hid.KeyA + 'y' - 'a'
+	want := []device.Packet{
+		{Type: device.PacketKeyboard, Modifier: hid.ModLeftShift},
+		{Type: device.PacketKeyboard, Code: hid.KeyA},
+		{Type: device.PacketKeyboard, Release: true, Code: hid.KeyA},
+		{Type: device.PacketKeyboard, Release: true, Modifier: hid.ModLeftShift},
+		{Type: device.PacketKeyboard, Code: keyY},
+		{Type: device.PacketKeyboard, Release: true, Code: keyY},
+		{Type: device.PacketConsumer, Code: 0xCD},
+		{Type: device.PacketConsumer, Release: true, Code: 0xCD},
+	}
+	if got := fake.Packets(); !slices.Equal(got, want) {
+		t.Errorf("packets = %v, want %v", got, want)
+	}
+}
+
+func TestSequencePlanning(t *testing.T) {
+	handler, fake := newTestHandler(t)
+	delay := `{"action":"delay","delay_ms":60000}`
+	tooMany := strings.TrimSuffix(strings.Repeat(`{"action":"delay"},`, maxSequenceSteps+1), ",")
+
+	tests := []struct {
+		name  string
+		steps string
+		want  string
+	}{
+		{"no steps", ``, "missing steps"},
+		{"invalid action", `{"action":"press","keys":"a"},{"action":"jump"}`, "step 1: invalid action"},
+		{"invalid chord", `{"action":"pressandrelease","keys":"cmd+"}`, "step 0: invalid key chord"},
+		{"keys and code", `{"action":"press","keys":"a","code":4}`, "step 0: keys cannot be combined"},
+		{"long hold", `{"action":"pressandrelease","keys":"a","hold_ms":60001}`, "step 0: hold_ms must not exceed"},
+		{"long delay", `{"action":"delay","delay_ms":60001}`, "step 0: delay_ms must not exceed"},
+		{"unsupported text", `{"action":"type","text":"é"}`, "step 0: layout"},
+		{"too many steps", tooMany, fmt.Sprintf("must not exceed %d steps", maxSequenceSteps)},
+		{"too long", strings.Join([]string{delay, delay, `{"action":"pressandrelease","keys":"a","hold_ms":1}`}, ","), "more than the 2m0s"},
+	}
+	for _, test := range tests {
+		status, body := post(t, handler, "/sequence", `{"steps":[`+test.steps+`]}`)
+		if status != http.StatusBadRequest || !strings.Contains(body, test.want) {
+			t.Errorf("%s: POST /sequence = %d %s, want 400 containing %q", test.name, status, body, test.want)
+		}
+	}
+	if packets := fake.Packets(); len(packets) != 0 {
+		t.Errorf("sent %v for invalid sequences", packets)
+	}
+
+	// Exactly the maximum duration is accepted.
+	if _, err := planSequence([]client.SequenceStep{
+		{Action: client.ActionDelay, DelayMS: 60000},
+		{Action: client.ActionDelay, DelayMS: 60000},
+	}); err != nil {
+		t.Errorf("planSequence at the maximum duration: %v", err)
+	}
+}
+
+func TestSequenceStopsOnFailure(t *testing.T) {
+	handler, fake := newTestHandler(t)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	go func() {
+		// Unplug the bridge while the sequence is in its delay.
+		if _, err := fake.WaitPackets(ctx, 2); err == nil {
+			fake.Unplug()
+		}
+	}()
+	status, body := post(t, handler, "/sequence", `{"steps":[
+		{"action":"pressandrelease","keys":"a"},
+		{"action":"delay","delay_ms":300},
+		{"action":"pressandrelease","keys":"b"},
+		{"action":"type","text":"c"}
+	]}`)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("POST /sequence = %d %s, want 503", status, body)
+	}
+	overall, statuses, resp := stepStatuses(t, body)
+	want := []string{client.StepOK, client.StepOK, client.StepFailed, client.StepSkipped}
+	if overall != client.StepFailed || !slices.Equal(statuses, want) {
+		t.Fatalf("statuses = %s %v, want failed %v", overall, statuses, want)
+	}
+	if failed := resp.Steps[2]; failed.Code != client.CodeDeviceDisconnected || failed.Error == "" {
+		t.Errorf("failed step = %+v, want a device_disconnected error", failed)
+	}
+	if packets := fake.Packets(); len(packets) != 2 {
+		t.Errorf("packets = %v, want only the first step's", packets)
+	}
+}
+
+func TestSequenceReleasesHeldKeysOnFailure(t *testing.T) {
+	handler, fake := newTestHandler(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go func() {
+		// Cancel the request while it is in its delay, leaving shift held.
+		if _, err := fake.WaitPackets(ctx, 1); err == nil {
+			cancel()
+		}
+	}()
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/sequence", strings.NewReader(`{"steps":[
+		{"action":"press","keys":"shift"},
+		{"action":"delay","delay_ms":5000},
+		{"action":"release","keys":"shift"}
+	]}`)).WithContext(ctx)
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("POST /sequence = %d %s, want 503", recorder.Code, recorder.Body)
+	}
+	overall, statuses, resp := stepStatuses(t, recorder.Body.String())
+	want := []string{client.StepOK, client.StepFailed, client.StepSkipped}
+	if overall != client.StepFailed || !slices.Equal(statuses, want) {
+		t.Fatalf("statuses = %s %v, want failed %v", overall, statuses, want)
+	}
+	if code := resp.Steps[1].Code; code != client.CodeQueueTimeout {
+		t.Errorf("canceled delay code = %s, want %s", code, client.CodeQueueTimeout)
+	}
+	wantPackets := []device.Packet{
+		{Type: device.PacketKeyboard, Modifier: hid.ModLeftShift},
+		{Type: device.PacketKeyboard, Release: true, Modifier: hid.ModLeftShift},
+	}
+	if got := fake.Packets(); !slices.Equal(got, wantPackets) {
+		t.Errorf("packets = %v, want shift released after the failure", got)
+	}
+}
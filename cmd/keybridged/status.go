@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+)
+
+// statusHandler serves `GET /status`.
+func statusHandler(devices *bridges) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w)
+			return
+		}
+		now := time.Now()
+		list := devices.all()
+		resp := client.StatusResponse{Devices: make([]client.DeviceStatus, 0, len(list))}
+		for _, entry := range list {
+			resp.Devices = append(resp.Devices, deviceStatus(entry.name, entry.manager.Status(), now))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func deviceStatus(name string, status device.Status, now time.Time) client.DeviceStatus {
+	resp := client.DeviceStatus{
+		Name:       name,
+		Selector:   status.Selector.String(),
+		Connected:  status.Connected,
+		Port:       status.Port,
+		Reconnects: status.Reconnects,
+		QueueDepth: status.QueueDepth,
+		Serial:     serialMode(status.Serial),
+	}
+	if status.VID != 0 || status.PID != 0 {
+		resp.VID = fmt.Sprintf("0x%04X", status.VID)
+		resp.PID = fmt.Sprintf("0x%04X", status.PID)
+	}
+	if !status.ConnectedAt.IsZero() {
+		connectedAt := status.ConnectedAt
+		resp.ConnectedAt = &connectedAt
+		resp.ConnectedSeconds = now.Sub(connectedAt).Seconds()
+	}
+	if status.LastError != nil {
+		lastErrorAt := status.LastErrorTime
+		resp.LastError = status.LastError.Error()
+		resp.LastErrorAt = &lastErrorAt
+	}
+	return resp
+}
+
+func serialMode(mode device.SerialMode) client.SerialMode {
+	stopBits, _ := strconv.ParseFloat(mode.StopBits.String(), 64)
+	return client.SerialMode{
+		BaudRate: mode.BaudRate,
+		DataBits: mode.DataBits,
+		Parity:   mode.Parity.String(),
+		StopBits: stopBits,
+		DTR:      mode.DTR == device.LineOn,
+		RTS:      mode.RTS == device.LineOn,
+		PulseMS:  mode.Pulse.Milliseconds(),
+	}
+}
+
+// healthzHandler serves `GET /healthz`: the process is up and serving.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pressReleaseResponse{Status: "ok"})
+}
+
+// readyzHandler serves `GET /readyz`: 200 once every bridge (or the one
+// named by ?device=) is connected, 503 otherwise.
+func readyzHandler(devices *bridges) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeMethodNotAllowed(w)
+			return
+		}
+		targets := devices.all()
+		if name := r.URL.Query().Get("device"); strings.TrimSpace(name) != "" {
+			target, ok := lookupDevice(w, devices, name)
+			if !ok {
+				return
+			}
+			targets = []*bridge{target}
+		}
+		resp := client.ReadyResponse{Status: "ok"}
+		for _, target := range targets {
+			if !target.manager.Status().Connected {
+				resp.Disconnected = append(resp.Disconnected, target.name)
+			}
+		}
+		status := http.StatusOK
+		if len(resp.Disconnected) > 0 {
+			resp.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/coder/websocket"
+)
+
+// maxStreamFrameBytes bounds a single WebSocket message; frames are small
+// JSON objects, plus text for "type" actions.
+const maxStreamFrameBytes = 64 << 10
+
+// streamHandler serves `GET /ws`. Frames are executed one at a time in the
+// order received and acknowledged once written to the bridge; the next
+// frame isn't read until then, so a slow bridge pushes back on the client
+// through the WebSocket.
+func streamHandler(devices *bridges, sendTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target, ok := lookupDevice(w, devices, r.URL.Query().Get("device"))
+		if !ok {
+			return
+		}
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			// Accept has already written the error response.
+			return
+		}
+		defer conn.CloseNow()
+		conn.SetReadLimit(maxStreamFrameBytes)
+
+		session := &streamSession{target: target, sendTimeout: sendTimeout, held: make(map[heldEvent]keyEvent)}
+		defer session.releaseHeld()
+
+		ctx := r.Context()
+		for {
+			_, data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			ack := session.handle(ctx, data)
+			payload, err := json.Marshal(ack)
+			if err != nil {
+				return
+			}
+			if err := conn.Write(ctx, websocket.MessageText, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// heldEvent identifies a usage pressed through a stream session.
+type heldEvent struct {
+	consumer bool
+	code     uint16
+}
+
+type streamSession struct {
+	target      *bridge
+	sendTimeout time.Duration
+	// held tracks keys pressed but not yet released by this session, so
+	// they can be released if the client goes away.
+	held map[heldEvent]keyEvent
+}
+
+func (s *streamSession) handle(ctx context.Context, data []byte) client.StreamAck {
+	var frame client.StreamFrame
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&frame); err != nil {
+		return client.StreamAck{ID: frame.ID, Status: client.StepFailed, Error: "invalid JSON frame", Code: client.CodeInvalidRequest}
+	}
+	op, err := planStep(frame.SequenceStep)
+	if err != nil {
+		return client.StreamAck{ID: frame.ID, Status: client.StepFailed, Error: err.Error(), Code: requestErrorCode(err)}
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, s.sendTimeout)
+	unlock, err := s.target.acquire(waitCtx)
+	cancel()
+	if err != nil {
+		return client.StreamAck{ID: frame.ID, Status: client.StepFailed, Error: err.Error(), Code: sendErrorCode(err)}
+	}
+	err = op.run(ctx, s.target.manager, s.sendTimeout)
+	unlock()
+	if err != nil {
+		return client.StreamAck{ID: frame.ID, Status: client.StepFailed, Error: err.Error(), Code: sendErrorCode(err)}
+	}
+	s.track(op)
+	return client.StreamAck{ID: frame.ID, Status: client.StepOK}
+}
+
+func (s *streamSession) track(op sequenceOp) {
+	if op.event == nil {
+		return
+	}
+	key := heldEvent{consumer: op.event.consumer, code: op.event.code}
+	switch op.action {
+	case client.ActionPress:
+		s.held[key] = *op.event
+	case client.ActionRelease:
+		delete(s.held, key)
+	}
+}
+
+func (s *streamSession) releaseHeld() {
+	if len(s.held) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+	defer cancel()
+	unlock, err := s.target.acquire(ctx)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	for _, event := range s.held {
+		_ = event.send(ctx, s.target.manager, true)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+)
+
+// systemdStatus reports bridge connection state to systemd as STATUS=
+// updates. It tracks state from device state changes, so it never calls
+// back into the managers.
+type systemdStatus struct {
+	logger    *slog.Logger
+	mu        sync.Mutex
+	names     []string
+	connected map[string]bool
+}
+
+func newSystemdStatus(names []string, logger *slog.Logger) *systemdStatus {
+	return &systemdStatus{
+		logger:    logger.With("component", "systemd"),
+		names:     names,
+		connected: make(map[string]bool, len(names)),
+	}
+}
+
+// setNames updates the bridges after a reload. Restarted bridges report
+// their state again, so their previous state is dropped.
+func (s *systemdStatus) setNames(names []string, restarted []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.names = names
+	for _, name := range restarted {
+		delete(s.connected, name)
+	}
+}
+
+// notify is a device.Config.OnStateChange hook.
+func (s *systemdStatus) notify(change device.StateChange) {
+	switch change.State {
+	case device.StateConnected, device.StateDisconnected:
+	default:
+		return
+	}
+	s.mu.Lock()
+	s.connected[change.Name] = change.State == device.StateConnected
+	status := s.statusLocked()
+	s.mu.Unlock()
+	s.send("STATUS=" + status)
+}
+
+// status describes the bridges' connection state in one line.
+func (s *systemdStatus) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+func (s *systemdStatus) statusLocked() string {
+	var waiting []string
+	for _, name := range s.names {
+		if !s.connected[name] {
+			waiting = append(waiting, name)
+		}
+	}
+	if len(waiting) == 0 {
+		return fmt.Sprintf("%d/%d bridges connected", len(s.names), len(s.names))
+	}
+	return fmt.Sprintf("%d/%d bridges connected, waiting for %s", len(s.names)-len(waiting), len(s.names), strings.Join(waiting, ", "))
+}
+
+func (s *systemdStatus) send(state string) {
+	if err := sdNotify(state); err != nil {
+		s.logger.Warn("sd_notify failed", "error", err)
+	}
+}
+
+// watchdog pings the systemd watchdog until stop is closed, as long as the
+// device managers respond. A deadlocked manager stops the pings, and
+// systemd restarts the daemon.
+func (s *systemdStatus) watchdog(devices *bridges, stop <-chan struct{}) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, entry := range devices.all() {
+				entry.manager.Status()
+			}
+			s.send("WATCHDOG=1")
+		}
+	}
+}
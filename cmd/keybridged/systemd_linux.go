@@ -0,0 +1,94 @@
+//go:build linux
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// activatedListeners returns the sockets passed by systemd socket activation
+// (LISTEN_PID/LISTEN_FDS), or none if the daemon wasn't socket-activated.
+// Stream sockets other than Unix sockets are served with tlsConfig, if set.
+func activatedListeners(tlsConfig *tls.Config) ([]listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	listeners := make([]listener, 0, count)
+	for i := range count {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("socket activation: %s: %w", name, err)
+		}
+		listeners = append(listeners, listener{
+			Listener: ln,
+			tls:      tlsConfig != nil && ln.Addr().Network() != "unix",
+		})
+	}
+	return listeners, nil
+}
+
+// sdNotify sends state to the service manager (see sd_notify(3)). It does
+// nothing unless the daemon runs under systemd with NOTIFY_SOCKET set.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		// Abstract socket.
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often to ping the systemd watchdog, or zero
+// if it isn't enabled for this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	// Ping at half the timeout, as recommended by sd_watchdog_enabled(3).
+	return time.Duration(usec) * time.Microsecond / 2
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// activatedListeners returns no listeners: socket activation is only
+// supported on Linux.
+func activatedListeners(*tls.Config) ([]listener, error) {
+	return nil, nil
+}
+
+func sdNotify(string) error {
+	return nil
+}
+
+func watchdogInterval() time.Duration {
+	return 0
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tlsOptions holds the TLS flags.
+type tlsOptions struct {
+	certFile string
+	keyFile  string
+	// clientCAFile enables mTLS: client certificates must be signed by one
+	// of these CAs.
+	clientCAFile string
+	// clientNamesFile maps client certificate common names to client names.
+	clientNamesFile string
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.certFile != "" || o.keyFile != ""
+}
+
+// serverConfig loads the certificates named by o. Client certificates are
+// verified if given, rather than required, so that probes can connect
+// without one; authenticate rejects other requests without one.
+func (o tlsOptions) serverConfig() (*tls.Config, error) {
+	if o.certFile == "" || o.keyFile == "" {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if o.clientCAFile != "" {
+		pem, err := os.ReadFile(o.clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client CA %s: no PEM certificates found", o.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// loadClientNames reads "name:common name" lines, skipping blank lines and
+// # comments, and returns a map from common name to client name.
+func loadClientNames(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open client names: %w", err)
+	}
+	defer file.Close()
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, commonName, ok := strings.Cut(text, ":")
+		name = strings.TrimSpace(name)
+		commonName = strings.TrimSpace(commonName)
+		if !ok || name == "" || commonName == "" {
+			return nil, fmt.Errorf("%s:%d: invalid entry (expected name:common name)", path, line)
+		}
+		if _, ok := names[commonName]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate common name %q", path, line, commonName)
+		}
+		names[commonName] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return names, nil
+}
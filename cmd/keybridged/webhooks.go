@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+)
+
+const (
+	// webhookQueue bounds the events waiting to be posted to one webhook;
+	// further events are dropped until it catches up.
+	webhookQueue   = 64
+	webhookTimeout = 5 * time.Second
+	// webhookCloseTimeout bounds how long closing waits for queued events
+	// to be posted before canceling the rest.
+	webhookCloseTimeout = 2 * time.Second
+)
+
+// webhookFlags collects repeated -webhook flags.
+type webhookFlags []string
+
+func (f *webhookFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *webhookFlags) Set(value string) error {
+	webhook, err := parseWebhookURL(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, webhook)
+	return nil
+}
+
+func parseWebhookURL(value string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("invalid webhook URL %q (expected http:// or https://)", value)
+	}
+	return parsed.String(), nil
+}
+
+// webhooks posts device state changes to the configured URLs. Each URL has
+// its own queue and goroutine, so a slow endpoint doesn't delay the others
+// or the device managers.
+type webhooks struct {
+	logger  *slog.Logger
+	http    *http.Client
+	targets []*webhookTarget
+	wg      sync.WaitGroup
+	// ctx is canceled when close gives up on the queued events.
+	ctx          context.Context
+	cancel       context.CancelFunc
+	closeTimeout time.Duration
+
+	// mu guards closed. notify holds it for reading while queueing, so close
+	// can't close a queue under a device goroutine that loaded h before a
+	// reload replaced it.
+	mu     sync.RWMutex
+	closed bool
+}
+
+type webhookTarget struct {
+	url    string
+	events chan client.DeviceEvent
+}
+
+func newWebhooks(urls []string, logger *slog.Logger) *webhooks {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &webhooks{
+		logger:       logger.With("component", "webhook"),
+		http:         &http.Client{Timeout: webhookTimeout},
+		ctx:          ctx,
+		cancel:       cancel,
+		closeTimeout: webhookCloseTimeout,
+	}
+	for _, u := range urls {
+		target := &webhookTarget{url: u, events: make(chan client.DeviceEvent, webhookQueue)}
+		h.targets = append(h.targets, target)
+		h.wg.Go(func() {
+			dropped := 0
+			for event := range target.events {
+				if h.ctx.Err() != nil {
+					dropped++
+					continue
+				}
+				h.post(target.url, event)
+			}
+			if dropped > 0 {
+				h.logger.Warn("dropped queued webhook events on close", "url", target.url, "count", dropped)
+			}
+		})
+	}
+	return h
+}
+
+// notify queues change for every webhook. It is used as
+// device.Config.OnStateChange and doesn't block.
+func (h *webhooks) notify(change device.StateChange) {
+	if len(h.targets) == 0 {
+		return
+	}
+	event := client.DeviceEvent{
+		Device: change.Name,
+		Event:  string(change.State),
+		Port:   change.Port,
+		Time:   change.Time,
+	}
+	if change.Err != nil {
+		event.Error = change.Err.Error()
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return
+	}
+	for _, target := range h.targets {
+		select {
+		case target.events <- event:
+		default:
+			h.logger.Warn("webhook queue full, dropping event", "url", target.url, "device", event.Device, "event", event.Event)
+		}
+	}
+}
+
+func (h *webhooks) post(u string, event client.DeviceEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		h.logger.Warn("webhook request failed", "url", u, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.http.Do(req)
+	if err != nil {
+		h.logger.Warn("webhook request failed", "url", u, "event", event.Event, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		h.logger.Warn("webhook rejected event", "url", u, "event", event.Event, "status", resp.Status)
+	}
+}
+
+// close waits up to closeTimeout for queued events to be posted, then
+// cancels the posts in flight and drops the rest. Later events are dropped.
+func (h *webhooks) close() {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		for _, target := range h.targets {
+			close(target.events)
+		}
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(h.closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		h.cancel()
+		<-done
+	}
+	h.cancel()
+}
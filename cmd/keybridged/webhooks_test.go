@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/client"
+	"github.com/2opremio/keybridged/device"
+)
+
+func TestWebhooksPostEvents(t *testing.T) {
+	events := make(chan client.DeviceEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event client.DeviceEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		events <- event
+	}))
+	defer server.Close()
+
+	hooks := newWebhooks([]string{server.URL}, slog.New(slog.DiscardHandler))
+	hooks.notify(device.StateChange{Name: "ipad", State: device.StateConnected, Port: "/dev/ttyACM0", Time: time.Now()})
+	hooks.close()
+
+	event := <-events
+	if event.Device != "ipad" || event.Event != "connected" || event.Port != "/dev/ttyACM0" {
+		t.Errorf("posted %+v, want ipad connected on /dev/ttyACM0", event)
+	}
+}
+
+// Device goroutines may still hold the previous webhooks while a reload
+// closes them.
+func TestWebhooksNotifyAfterClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	hooks := newWebhooks([]string{server.URL}, slog.New(slog.DiscardHandler))
+	change := device.StateChange{Name: "ipad", State: device.StateDisconnected, Time: time.Now()}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 100 {
+				hooks.notify(change)
+			}
+		})
+	}
+	hooks.close()
+	wg.Wait()
+	hooks.notify(change)
+	hooks.close()
+}
+
+func TestWebhooksCloseCancelsSlowPosts(t *testing.T) {
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	hooks := newWebhooks([]string{server.URL}, slog.New(slog.DiscardHandler))
+	hooks.closeTimeout = 50 * time.Millisecond
+	for range webhookQueue {
+		hooks.notify(device.StateChange{Name: "ipad", State: device.StateLost, Time: time.Now()})
+	}
+	start := time.Now()
+	hooks.close()
+	if elapsed := time.Since(start); elapsed > webhookTimeout {
+		t.Errorf("close took %s with an unresponsive endpoint", elapsed)
+	}
+}
@@ -0,0 +1,328 @@
+// Package devicetest provides an in-memory keybridge for exercising
+// device.Manager and the daemon without hardware.
+package devicetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/2opremio/keybridged/device"
+)
+
+const (
+	DefaultPortName = "/dev/fake-keybridge"
+)
+
+var (
+	// ErrUnplugged is returned by transport operations after Unplug.
+	ErrUnplugged = errors.New("fake bridge unplugged")
+)
+
+// Config configures a fake Bridge.
+type Config struct {
+	// Port is reported by ListPorts. Name defaults to DefaultPortName and
+	// VID/PID default to device.DefaultVID/device.DefaultPID.
+	Port device.PortDetails
+	// Banner lines are written to the host every time the bridge is opened,
+	// like the firmware's boot log.
+	Banner []string
+	// Unplugged starts the bridge detached.
+	Unplugged bool
+}
+
+// Bridge is an in-memory bridge implementing device.Dialer.
+//
+// It decodes and records every packet the Manager writes, lets tests emit
+// firmware log lines, and can simulate unplugging and replugging the device.
+type Bridge struct {
+	mu       sync.Mutex
+	changed  chan struct{}
+	port     device.PortDetails
+	banner   []string
+	plugged  bool
+	openErr  error
+	conn     *conn
+	opens    int
+	packets  []device.Packet
+	leftover []byte
+}
+
+// NewBridge returns a fake bridge, plugged in unless config.Unplugged is set.
+func NewBridge(config Config) *Bridge {
+	port := config.Port
+	if port.Name == "" {
+		port.Name = DefaultPortName
+	}
+	if port.VID == "" && port.PID == "" {
+		port.IsUSB = true
+		port.VID = fmt.Sprintf("%04X", device.DefaultVID)
+		port.PID = fmt.Sprintf("%04X", device.DefaultPID)
+	}
+	return &Bridge{
+		changed: make(chan struct{}),
+		port:    port,
+		banner:  append([]string(nil), config.Banner...),
+		plugged: !config.Unplugged,
+	}
+}
+
+// ListPorts implements device.Dialer.
+func (b *Bridge) ListPorts() ([]device.PortDetails, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.plugged {
+		return nil, nil
+	}
+	return []device.PortDetails{b.port}, nil
+}
+
+// Dial implements device.Dialer.
+func (b *Bridge) Dial(name string) (device.Transport, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.plugged || name != b.port.Name {
+		return nil, fmt.Errorf("open %s: no such device", name)
+	}
+	if b.openErr != nil {
+		return nil, b.openErr
+	}
+	if b.conn != nil {
+		return nil, fmt.Errorf("open %s: device busy", name)
+	}
+	c := newConn(b)
+	for _, line := range b.banner {
+		c.feed([]byte(line + "\n"))
+	}
+	b.conn = c
+	b.opens++
+	b.leftover = nil
+	b.notifyLocked()
+	return c, nil
+}
+
+// Log writes a firmware log line to the connected host. It returns false
+// if no host has the bridge open.
+func (b *Bridge) Log(line string) bool {
+	b.mu.Lock()
+	c := b.conn
+	b.mu.Unlock()
+	if c == nil {
+		return false
+	}
+	return c.feed([]byte(line + "\n"))
+}
+
+// Unplug simulates detaching the device: the open transport fails and the
+// port disappears from discovery.
+func (b *Bridge) Unplug() {
+	b.mu.Lock()
+	c := b.conn
+	b.plugged = false
+	b.conn = nil
+	b.notifyLocked()
+	b.mu.Unlock()
+	if c != nil {
+		c.fail(ErrUnplugged)
+	}
+}
+
+// Plug makes the device discoverable again.
+func (b *Bridge) Plug() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.plugged = true
+	b.notifyLocked()
+}
+
+// SetOpenError makes subsequent Dial calls fail with err. Pass nil to clear it.
+func (b *Bridge) SetOpenError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.openErr = err
+}
+
+// Connected reports whether a host currently has the bridge open.
+func (b *Bridge) Connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn != nil
+}
+
+// Opens returns how many times the bridge has been opened.
+func (b *Bridge) Opens() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.opens
+}
+
+// Packets returns a copy of every packet received so far.
+func (b *Bridge) Packets() []device.Packet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]device.Packet(nil), b.packets...)
+}
+
+// Reset discards the recorded packets.
+func (b *Bridge) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.packets = nil
+}
+
+// WaitConnected blocks until a host opens the bridge or ctx is done.
+func (b *Bridge) WaitConnected(ctx context.Context) error {
+	return b.wait(ctx, func() bool { return b.conn != nil })
+}
+
+// WaitPackets blocks until at least n packets were received and returns them.
+func (b *Bridge) WaitPackets(ctx context.Context, n int) ([]device.Packet, error) {
+	if err := b.wait(ctx, func() bool { return len(b.packets) >= n }); err != nil {
+		return b.Packets(), err
+	}
+	return b.Packets(), nil
+}
+
+func (b *Bridge) wait(ctx context.Context, cond func() bool) error {
+	for {
+		b.mu.Lock()
+		ok := cond()
+		changed := b.changed
+		b.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (b *Bridge) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *Bridge) receive(c *conn, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != c {
+		return ErrUnplugged
+	}
+	b.leftover = append(b.leftover, data...)
+	for len(b.leftover) >= device.PacketLen {
+		packet, err := device.DecodePacket(b.leftover[:device.PacketLen])
+		b.leftover = b.leftover[device.PacketLen:]
+		if err != nil {
+			return err
+		}
+		b.packets = append(b.packets, packet)
+	}
+	b.notifyLocked()
+	return nil
+}
+
+func (b *Bridge) release(c *conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == c {
+		b.conn = nil
+		b.notifyLocked()
+	}
+}
+
+// conn is the host side of an open fake bridge.
+type conn struct {
+	bridge *Bridge
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	err  error
+}
+
+func newConn(bridge *Bridge) *conn {
+	c := &conn{bridge: bridge}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.buf.Len() == 0 && c.err == nil {
+		c.cond.Wait()
+	}
+	if c.buf.Len() > 0 {
+		return c.buf.Read(p)
+	}
+	return 0, c.err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if err := c.bridge.receive(c, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *conn) Close() error {
+	c.fail(io.ErrClosedPipe)
+	c.bridge.release(c)
+	return nil
+}
+
+func (c *conn) feed(data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false
+	}
+	_, _ = c.buf.Write(data)
+	c.cond.Broadcast()
+	return true
+}
+
+func (c *conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+}
+
+// Ports is a device.Dialer serving several fake bridges, as if each was
+// plugged into its own USB port. Give the bridges distinct port names.
+type Ports []*Bridge
+
+// ListPorts implements device.Dialer.
+func (p Ports) ListPorts() ([]device.PortDetails, error) {
+	var ports []device.PortDetails
+	for _, bridge := range p {
+		listed, _ := bridge.ListPorts()
+		ports = append(ports, listed...)
+	}
+	return ports, nil
+}
+
+// Dial implements device.Dialer.
+func (p Ports) Dial(name string) (device.Transport, error) {
+	for _, bridge := range p {
+		if bridge.port.Name == name {
+			return bridge.Dial(name)
+		}
+	}
+	return nil, fmt.Errorf("open %s: no such device", name)
+}
@@ -0,0 +1,47 @@
+package device
+
+import "time"
+
+// State is a connection state transition reported to Config.OnStateChange.
+type State string
+
+const (
+	// StateFound is reported when discovery finds a matching USB serial
+	// adapter, or finds it on a different port. It isn't reported for
+	// Selector.Path.
+	StateFound State = "found"
+	// StateLost is reported when a previously found adapter is no longer
+	// enumerated.
+	StateLost State = "lost"
+	// StateConnected is reported once the serial port is open.
+	StateConnected State = "connected"
+	// StateDisconnected is reported when the serial port is closed after an
+	// I/O error, or by Close (with ErrClosed).
+	StateDisconnected State = "disconnected"
+)
+
+// StateChange describes a connection state transition.
+type StateChange struct {
+	// Name is the bridge name from Config.
+	Name  string
+	State State
+	// Port is the serial port involved. It is empty for StateLost.
+	Port string
+	// Err is the reason for StateDisconnected.
+	Err  error
+	Time time.Time
+}
+
+// notifyState calls Config.OnStateChange, if set.
+func (m *Manager) notifyState(state State, port string, err error) {
+	if m.onStateChange == nil {
+		return
+	}
+	m.onStateChange(StateChange{
+		Name:  m.name,
+		State: state,
+		Port:  port,
+		Err:   err,
+		Time:  time.Now(),
+	})
+}
@@ -0,0 +1,84 @@
+package device_test
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+// stateRecorder collects the changes reported to Config.OnStateChange.
+type stateRecorder struct {
+	mu      sync.Mutex
+	changes []device.StateChange
+}
+
+func (r *stateRecorder) record(change device.StateChange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, change)
+}
+
+func (r *stateRecorder) states() []device.State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make([]device.State, 0, len(r.changes))
+	for _, change := range r.changes {
+		states = append(states, change.State)
+	}
+	return states
+}
+
+func (r *stateRecorder) at(i int) device.StateChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changes[i]
+}
+
+func (r *stateRecorder) last() device.StateChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changes[len(r.changes)-1]
+}
+
+func TestStateChangeOrder(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	var recorder stateRecorder
+	manager := device.NewManager(device.Config{
+		Name:          "ipad",
+		Dialer:        bridge,
+		Logger:        slog.New(slog.DiscardHandler),
+		OnStateChange: recorder.record,
+	})
+	waitConnected(t, ctx, manager, true)
+
+	bridge.Unplug()
+	waitFor(t, ctx, "lost", func() bool { return len(recorder.states()) >= 4 })
+	bridge.Plug()
+	waitFor(t, ctx, "reconnect", func() bool { return len(recorder.states()) >= 6 })
+	manager.Close()
+
+	want := []device.State{
+		device.StateFound, device.StateConnected,
+		device.StateDisconnected, device.StateLost,
+		device.StateFound, device.StateConnected,
+		device.StateDisconnected,
+	}
+	if got := recorder.states(); !slices.Equal(got, want) {
+		t.Fatalf("states = %v, want %v", got, want)
+	}
+	last := recorder.last()
+	if last.Name != "ipad" || last.Port != devicetest.DefaultPortName || !errors.Is(last.Err, device.ErrClosed) {
+		t.Errorf("final change = %+v, want ipad disconnected from %s with ErrClosed", last, devicetest.DefaultPortName)
+	}
+	for i, change := range recorder.changes[1:] {
+		if change.Time.Before(recorder.changes[i].Time) {
+			t.Errorf("change %d (%s) reported before the previous one", i+1, change.State)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// releaseTimeout bounds the automatic releases sent on reconnect, on Close
+// and after a failed press/release pair.
+const releaseTimeout = time.Second
+
+// heldKey identifies a usage the bridge is currently holding down.
+type heldKey struct {
+	Type PacketType
+	Code uint16
+}
+
+// heldState is the modifier and flags sent with the press, which are
+// repeated in the release.
+type heldState struct {
+	Modifier byte
+	Flags    byte
+}
+
+// trackWritten updates the held usages after a packet reached the bridge.
+func (m *Manager) trackWritten(packet [keybridgePacketLen]byte) {
+	decoded, err := DecodePacket(packet[:])
+	if err != nil {
+		return
+	}
+	key := heldKey{Type: decoded.Type, Code: decoded.Code}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if decoded.Release {
+		delete(m.held, key)
+		return
+	}
+	m.held[key] = heldState{Modifier: decoded.Modifier, Flags: decoded.Flags}
+}
+
+func (m *Manager) heldPackets(keys []heldKey) []Packet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var packets []Packet
+	add := func(key heldKey, state heldState) {
+		packets = append(packets, Packet{
+			Type:     key.Type,
+			Release:  true,
+			Code:     key.Code,
+			Modifier: state.Modifier,
+			Flags:    state.Flags,
+		})
+	}
+	if keys == nil {
+		for key, state := range m.held {
+			add(key, state)
+		}
+		return packets
+	}
+	for _, key := range keys {
+		if state, ok := m.held[key]; ok {
+			add(key, state)
+		}
+	}
+	return packets
+}
+
+// ReleaseAll sends a release for every keyboard and consumer usage the
+// bridge is currently holding down.
+func (m *Manager) ReleaseAll(ctx context.Context) error {
+	return m.release(ctx, nil)
+}
+
+// release sends releases for the given held usages, or for all of them if
+// keys is nil.
+func (m *Manager) release(ctx context.Context, keys []heldKey) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var errs []error
+	written := false
+	for _, packet := range m.heldPackets(keys) {
+		if err := m.enqueuePacket(ctx, packet.Encode()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		written = true
+	}
+	if written {
+		for i, err := range errs {
+			errs[i] = partlySent(err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// releaseAfterFailure releases usages left held by a failed send, using its
+// own timeout since the caller's context may be what failed.
+func (m *Manager) releaseAfterFailure(keys []heldKey) {
+	if m.currentPort() == nil {
+		// Held usages are released once the bridge reconnects.
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	if err := m.release(ctx, keys); err != nil {
+		m.logger.Warn("failed to release held keys", "error", err)
+	}
+}
+
+// releaseOnReconnect releases usages that were held when the previous
+// connection dropped.
+func (m *Manager) releaseOnReconnect() {
+	if len(m.heldPackets(nil)) == 0 {
+		return
+	}
+	m.logger.Info("releasing keys held before reconnect")
+	m.releaseAfterFailure(nil)
+}
+
+// PressAndReleaseKeyboard sends a keyboard press, waits for hold (which may
+// be zero) and sends the release. If any step fails, the key is released on
+// a best-effort basis so the target host isn't left with a stuck key or
+// modifier.
+func (m *Manager) PressAndReleaseKeyboard(ctx context.Context, keyCode uint16, modifier byte, flags byte, hold time.Duration) error {
+	return m.pressAndRelease(ctx, heldKey{Type: PacketKeyboard, Code: keyCode}, hold, func(release bool) error {
+		return m.SendKeyboard(ctx, keyCode, modifier, flags, release)
+	})
+}
+
+// PressAndReleaseConsumer sends a consumer control press and release, with
+// the same hold and safety net as PressAndReleaseKeyboard.
+func (m *Manager) PressAndReleaseConsumer(ctx context.Context, usage uint16, hold time.Duration) error {
+	return m.pressAndRelease(ctx, heldKey{Type: PacketConsumer, Code: usage}, hold, func(release bool) error {
+		return m.SendConsumer(ctx, usage, release)
+	})
+}
+
+func (m *Manager) pressAndRelease(ctx context.Context, key heldKey, hold time.Duration, send func(release bool) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := send(false); err != nil {
+		m.releaseAfterFailure([]heldKey{key})
+		return err
+	}
+	if hold > 0 {
+		timer := time.NewTimer(hold)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-m.stopCh:
+			return ErrClosed
+		case <-ctx.Done():
+			m.releaseAfterFailure([]heldKey{key})
+			return fmt.Errorf("keybridge hold canceled: %w", ctx.Err())
+		}
+	}
+	if err := send(true); err != nil {
+		m.releaseAfterFailure([]heldKey{key})
+		return partlySent(err)
+	}
+	return nil
+}
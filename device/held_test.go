@@ -0,0 +1,136 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+func TestReleaseAll(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	for _, send := range []func() error{
+		func() error { return manager.SendKeyboard(ctx, 0x04, 0x02, 0, false) },
+		func() error { return manager.SendKeyboard(ctx, 0x05, 0, 0, false) },
+		func() error { return manager.SendKeyboard(ctx, 0x05, 0, 0, true) },
+	} {
+		if err := send(); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	bridge.Reset()
+
+	if err := manager.ReleaseAll(ctx); err != nil {
+		t.Fatalf("ReleaseAll: %v", err)
+	}
+	want := []device.Packet{{Type: device.PacketKeyboard, Release: true, Code: 0x04, Modifier: 0x02}}
+	if got := bridge.Packets(); !slices.Equal(got, want) {
+		t.Errorf("ReleaseAll sent %v, want %v", got, want)
+	}
+
+	bridge.Reset()
+	if err := manager.ReleaseAll(ctx); err != nil {
+		t.Fatalf("second ReleaseAll: %v", err)
+	}
+	if got := bridge.Packets(); len(got) != 0 {
+		t.Errorf("second ReleaseAll sent %v, want nothing", got)
+	}
+}
+
+func TestPressAndReleaseHold(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	const hold = 50 * time.Millisecond
+	start := time.Now()
+	if err := manager.PressAndReleaseConsumer(ctx, 0x30, hold); err != nil {
+		t.Fatalf("PressAndReleaseConsumer: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < hold {
+		t.Errorf("returned after %v, want at least %v", elapsed, hold)
+	}
+	want := []device.Packet{
+		{Type: device.PacketConsumer, Code: 0x30},
+		{Type: device.PacketConsumer, Release: true, Code: 0x30},
+	}
+	if got := bridge.Packets(); !slices.Equal(got, want) {
+		t.Errorf("packets = %v, want %v", got, want)
+	}
+}
+
+func TestCanceledHoldReleasesKey(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	holdCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	err := manager.PressAndReleaseKeyboard(holdCtx, 0x04, 0x02, 0, time.Minute)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PressAndReleaseKeyboard = %v, want DeadlineExceeded", err)
+	}
+	want := []device.Packet{
+		{Type: device.PacketKeyboard, Code: 0x04, Modifier: 0x02},
+		{Type: device.PacketKeyboard, Release: true, Code: 0x04, Modifier: 0x02},
+	}
+	if got := bridge.Packets(); !slices.Equal(got, want) {
+		t.Errorf("packets = %v, want %v", got, want)
+	}
+}
+
+// Once the press was written, a failed release doesn't mean nothing was
+// sent.
+func TestFailedReleaseIsNotNotSent(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	go func() {
+		if _, err := bridge.WaitPackets(ctx, 1); err == nil {
+			bridge.Unplug()
+		}
+	}()
+	err := manager.PressAndReleaseKeyboard(ctx, 0x04, 0, 0, 200*time.Millisecond)
+	if !errors.Is(err, device.ErrNotConnected) || errors.Is(err, device.ErrNotSent) {
+		t.Errorf("PressAndReleaseKeyboard = %v, want ErrNotConnected without ErrNotSent", err)
+	}
+}
+
+func TestCloseReleasesHeldKeys(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := device.NewManager(device.Config{Dialer: bridge, Logger: slog.New(slog.DiscardHandler)})
+	waitConnected(t, ctx, manager, true)
+
+	if err := manager.SendConsumer(ctx, 0xE9, false); err != nil {
+		t.Fatalf("SendConsumer: %v", err)
+	}
+	manager.Close()
+
+	want := []device.Packet{
+		{Type: device.PacketConsumer, Code: 0xE9},
+		{Type: device.PacketConsumer, Release: true, Code: 0xE9},
+	}
+	if got := bridge.Packets(); !slices.Equal(got, want) {
+		t.Errorf("packets = %v, want %v", got, want)
+	}
+	if bridge.Connected() {
+		t.Error("bridge still open after Close")
+	}
+	if err := manager.SendConsumer(ctx, 0xE9, false); !errors.Is(err, device.ErrNotConnected) && !errors.Is(err, device.ErrClosed) {
+		t.Errorf("SendConsumer after Close = %v, want ErrNotConnected or ErrClosed", err)
+	}
+}
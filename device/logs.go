@@ -0,0 +1,147 @@
+package device
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogBacklog is how many recent device log lines are kept when
+	// Config.LogBacklog isn't set.
+	DefaultLogBacklog = 256
+	// logSubscriberBuffer is how many lines a subscriber may fall behind
+	// before lines are dropped for it.
+	logSubscriberBuffer = 256
+)
+
+// LogLine is a line of output read from the bridge firmware.
+type LogLine struct {
+	Time time.Time
+	Text string
+	// Truncated is set when the line exceeded the maximum log line length
+	// and was split; the rest of it follows in the next LogLine.
+	Truncated bool
+}
+
+// logHub keeps recent device log lines and fans new ones out to subscribers.
+type logHub struct {
+	mu          sync.Mutex
+	backlog     []LogLine
+	next        int
+	full        bool
+	subscribers map[chan LogLine]struct{}
+	closed      bool
+}
+
+func newLogHub(size int) *logHub {
+	return &logHub{
+		backlog:     make([]LogLine, size),
+		subscribers: make(map[chan LogLine]struct{}),
+	}
+}
+
+func (h *logHub) publish(line LogLine) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backlog[h.next] = line
+	h.next = (h.next + 1) % len(h.backlog)
+	if h.next == 0 {
+		h.full = true
+	}
+	for ch := range h.subscribers {
+		select {
+		case ch <- line:
+		default:
+			// Slow subscriber: drop the line rather than stall the reader.
+		}
+	}
+}
+
+// recentLocked returns up to n of the most recent lines, oldest first.
+func (h *logHub) recentLocked(n int) []LogLine {
+	count := h.next
+	if h.full {
+		count = len(h.backlog)
+	}
+	if n > count {
+		n = count
+	}
+	lines := make([]LogLine, 0, n)
+	start := h.next - n
+	if start < 0 {
+		start += len(h.backlog)
+	}
+	for i := 0; i < n; i++ {
+		lines = append(lines, h.backlog[(start+i)%len(h.backlog)])
+	}
+	return lines
+}
+
+func (h *logHub) subscribe(replay int) (<-chan LogLine, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	recent := h.recentLocked(replay)
+	ch := make(chan LogLine, logSubscriberBuffer+len(recent))
+	for _, line := range recent {
+		ch <- line
+	}
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subscribers[ch] = struct{}{}
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// close may already have closed ch.
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// close closes every subscriber's channel; later subscribers get a closed
+// channel after the replayed lines.
+func (h *logHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// RecentLogs returns the most recent device log lines read after since,
+// oldest first. A zero since returns every kept line; a positive limit
+// keeps only the last limit lines.
+func (m *Manager) RecentLogs(since time.Time, limit int) []LogLine {
+	h := m.logs
+	h.mu.Lock()
+	lines := h.recentLocked(len(h.backlog))
+	h.mu.Unlock()
+	if !since.IsZero() {
+		first := len(lines)
+		for i, line := range lines {
+			if line.Time.After(since) {
+				first = i
+				break
+			}
+		}
+		lines = lines[first:]
+	}
+	if limit > 0 && len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+	return lines
+}
+
+// SubscribeLogs returns a channel receiving device log lines as they are
+// read, starting with up to replay of the most recent ones. Lines are
+// dropped if the receiver falls behind. The channel is closed by cancel, or
+// when the Manager is closed.
+func (m *Manager) SubscribeLogs(replay int) (lines <-chan LogLine, cancel func()) {
+	return m.logs.subscribe(replay)
+}
@@ -0,0 +1,145 @@
+package device_test
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+// waitLogs waits until the Manager has read at least n log lines and
+// returns their text.
+func waitLogs(t *testing.T, manager *device.Manager, n int) []string {
+	t.Helper()
+	ctx := testContext(t)
+	waitFor(t, ctx, "device logs", func() bool { return len(manager.RecentLogs(time.Time{}, 0)) >= n })
+	return logTexts(manager.RecentLogs(time.Time{}, 0))
+}
+
+func logTexts(lines []device.LogLine) []string {
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	return texts
+}
+
+func TestSubscribeLogs(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{Banner: []string{"boot", "ready"}})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitLogs(t, manager, 2)
+
+	lines, cancel := manager.SubscribeLogs(1)
+	if !bridge.Log("key pressed\r") {
+		t.Fatal("bridge not open")
+	}
+	var got []string
+	for len(got) < 2 {
+		select {
+		case line := <-lines:
+			got = append(got, line.Text)
+		case <-ctx.Done():
+			t.Fatalf("timed out, got %q", got)
+		}
+	}
+	if want := []string{"ready", "key pressed"}; !slices.Equal(got, want) {
+		t.Errorf("subscriber got %q, want %q", got, want)
+	}
+
+	cancel()
+	cancel()
+	for range lines {
+		// Drain lines published before cancel; the channel must close.
+	}
+}
+
+func TestRecentLogsRing(t *testing.T) {
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{LogBacklog: 3})
+	waitConnected(t, testContext(t), manager, true)
+
+	bridge.Log("one")
+	bridge.Log("two")
+	waitLogs(t, manager, 2)
+	since := time.Now()
+	for _, line := range []string{"three", "four", "five"} {
+		bridge.Log(line)
+	}
+	waitFor(t, testContext(t), "last log line", func() bool {
+		lines := manager.RecentLogs(time.Time{}, 0)
+		return len(lines) > 0 && lines[len(lines)-1].Text == "five"
+	})
+
+	if got, want := logTexts(manager.RecentLogs(time.Time{}, 0)), []string{"three", "four", "five"}; !slices.Equal(got, want) {
+		t.Errorf("RecentLogs = %q, want %q", got, want)
+	}
+	if got, want := logTexts(manager.RecentLogs(time.Time{}, 2)), []string{"four", "five"}; !slices.Equal(got, want) {
+		t.Errorf("RecentLogs limit 2 = %q, want %q", got, want)
+	}
+	if got, want := logTexts(manager.RecentLogs(since, 0)), []string{"three", "four", "five"}; !slices.Equal(got, want) {
+		t.Errorf("RecentLogs since = %q, want %q", got, want)
+	}
+	if got := manager.RecentLogs(time.Now(), 0); len(got) != 0 {
+		t.Errorf("RecentLogs since now = %v, want none", got)
+	}
+}
+
+func TestLongLogLinesAreTruncated(t *testing.T) {
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, testContext(t), manager, true)
+
+	long := strings.Repeat("x", 20000)
+	bridge.Log(long)
+	bridge.Log("short")
+	waitLogs(t, manager, 3)
+
+	lines := manager.RecentLogs(time.Time{}, 0)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want the long line split in two and the short one", len(lines))
+	}
+	if !lines[0].Truncated || lines[1].Truncated || lines[2].Truncated {
+		t.Errorf("truncated flags = %v %v %v, want true false false", lines[0].Truncated, lines[1].Truncated, lines[2].Truncated)
+	}
+	if lines[0].Text+lines[1].Text != long {
+		t.Error("split long line doesn't add up to the original")
+	}
+	if lines[2].Text != "short" {
+		t.Errorf("line after the long one = %q, want %q", lines[2].Text, "short")
+	}
+}
+
+func TestCloseEndsLogSubscriptions(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{Banner: []string{"boot"}})
+	manager := device.NewManager(device.Config{Dialer: bridge, Logger: slog.New(slog.DiscardHandler)})
+	waitLogs(t, manager, 1)
+
+	lines, cancel := manager.SubscribeLogs(0)
+	defer cancel()
+	manager.Close()
+	select {
+	case _, ok := <-lines:
+		if ok {
+			t.Error("got a line after Close")
+		}
+	case <-ctx.Done():
+		t.Fatal("subscription not closed by Close")
+	}
+	cancel()
+
+	// Subscribing after Close still replays the kept lines.
+	lines, _ = manager.SubscribeLogs(1)
+	var got []string
+	for line := range lines {
+		got = append(got, line.Text)
+	}
+	if want := []string{"boot"}; !slices.Equal(got, want) {
+		t.Errorf("subscription after Close got %q, want %q", got, want)
+	}
+}
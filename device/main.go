@@ -10,16 +10,15 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"go.bug.st/serial"
-	"go.bug.st/serial/enumerator"
 )
 
 const (
 	DefaultVID         = 0x1915
 	DefaultPID         = 0x520F
-	defaultBaudRate    = 115200
+	DefaultBaudRate    = 115200
+	DefaultDataBits    = 8
 	keybridgePacketLen = 5
 	defaultWriteQueue  = 1
 	maxLogLineBytes    = 16384
@@ -31,64 +30,144 @@ const (
 	keybridgeReleaseFlag  = 0x80
 )
 
+// KeyboardFlagAppleFn sets the Apple Fn bit in the bridge's keyboard report.
+const KeyboardFlagAppleFn = 0x01
+
+var (
+	// ErrNotConnected is returned when no bridge is connected, including when
+	// it disconnects after a packet was queued but before it was written.
+	ErrNotConnected = errors.New("keybridge not connected")
+	// ErrClosed is returned for sends after Close.
+	ErrClosed = errors.New("keybridge closed")
+	// ErrNotSent is wrapped by errors of sends rejected before their packet
+	// was queued for the bridge, such as ErrNotConnected when no bridge is
+	// connected. Retrying them can't repeat a key event. Errors of
+	// multi-packet sends only wrap it if none of their packets was written.
+	ErrNotSent = errors.New("packet not sent")
+)
+
+// notSentError marks a send error as returned before the packet was queued.
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notSentError) Unwrap() []error {
+	return []error{e.err, ErrNotSent}
+}
+
+// partlySent drops the ErrNotSent mark from err, for sends that had already
+// written some of their packets.
+func partlySent(err error) error {
+	if notSent, ok := err.(*notSentError); ok {
+		return notSent.err
+	}
+	return err
+}
+
 var (
 	errDeviceNotFound = errors.New("USB serial adapter not found")
 	errUSBOpenFailed  = errors.New("USB serial port open failed")
+	errAmbiguousPort  = errors.New("multiple USB serial adapters match")
 )
 
 type Manager struct {
 	mu       sync.Mutex
 	writeMu  sync.Mutex
-	port     serial.Port
+	port     Transport
 	portName string
 	stopCh   chan struct{}
 	wg       sync.WaitGroup
 	logger   *slog.Logger
-	vid      uint16
-	pid      uint16
-
-	writeCh           chan [keybridgePacketLen]byte
+	dialer   Dialer
+	name     string
+	selector Selector
+	serial   SerialMode
+
+	writeCh chan writeRequest
+	// queued counts packets passed to enqueuePacket that haven't been
+	// written or given up on yet; writeCh only holds one of them.
+	queued            atomic.Int64
+	held              map[heldKey]heldState
+	logs              *logHub
+	stats             *managerStats
+	onStateChange     func(StateChange)
 	openFailureCount  int
 	openFailuresMuted bool
 	lastFoundPort     string
 	lastFound         bool
+	lastAmbiguous     string
+
+	// Connection history reported by Status.
+	portDetails   PortDetails
+	connectedAt   time.Time
+	connects      int
+	lastError     error
+	lastErrorTime time.Time
 }
 
 type Config struct {
 	Logger *slog.Logger
-	VID    uint16
-	PID    uint16
+	// Name identifies the bridge when a process drives several of them.
+	Name string
+	// Selector chooses the serial port to drive. The zero value matches the
+	// first port with DefaultVID/DefaultPID.
+	Selector Selector
+	// Dialer discovers and opens the bridge transport. Defaults to the
+	// go.bug.st/serial implementation.
+	Dialer Dialer
+	// Serial is the mode the default Dialer opens the serial port with.
+	Serial SerialMode
+	// LogBacklog is how many recent device log lines are kept for
+	// RecentLogs and SubscribeLogs replay. Defaults to 256.
+	LogBacklog int
+	// OnStateChange, if set, is called on every connection state
+	// transition. It is called from the Manager's goroutines, in order, and
+	// must return quickly.
+	OnStateChange func(StateChange)
 }
 
 func NewManager(config Config) *Manager {
 	manager := &Manager{
 		stopCh:  make(chan struct{}),
-		writeCh: make(chan [keybridgePacketLen]byte, defaultWriteQueue),
+		writeCh: make(chan writeRequest, defaultWriteQueue),
+		held:    make(map[heldKey]heldState),
+		stats:   newManagerStats(),
+	}
+	logBacklog := config.LogBacklog
+	if logBacklog <= 0 {
+		logBacklog = DefaultLogBacklog
 	}
+	manager.logs = newLogHub(logBacklog)
 	if config.Logger != nil {
 		manager.logger = config.Logger
 	} else {
 		manager.logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
 	}
 	manager.logger = manager.logger.With("component", "device")
-	manager.vid = config.VID
-	manager.pid = config.PID
-	if manager.vid == 0 {
-		manager.vid = DefaultVID
+	manager.name = config.Name
+	if manager.name != "" {
+		manager.logger = manager.logger.With("device", manager.name)
 	}
-	if manager.pid == 0 {
-		manager.pid = DefaultPID
+	manager.serial = config.Serial.withDefaults()
+	manager.dialer = config.Dialer
+	if manager.dialer == nil {
+		manager.dialer = serialDialer{mode: manager.serial}
 	}
+	manager.selector = config.Selector.withDefaults()
+	manager.onStateChange = config.OnStateChange
 	manager.wg.Go(manager.reconnectLoop)
 	manager.wg.Go(manager.deviceLogReadLoop)
 	manager.wg.Go(manager.writeWorker)
 	return manager
 }
 
+// SendKeyboard writes a keyboard packet to the bridge. It returns once the
+// packet has been written to the serial port, or with the reason it wasn't.
 func (m *Manager) SendKeyboard(ctx context.Context, keyCode uint16, modifier byte, flags byte, release bool) error {
-	if m.currentPort() == nil {
-		return fmt.Errorf("keybridge not connected")
-	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -97,13 +176,16 @@ func (m *Manager) SendKeyboard(ctx context.Context, keyCode uint16, modifier byt
 		typeByte |= keybridgeReleaseFlag
 	}
 	packet := buildPacket(typeByte, keyCode, modifier, flags)
+	if m.currentPort() == nil {
+		m.stats.addDropped(packet)
+		return &notSentError{ErrNotConnected}
+	}
 	return m.enqueuePacket(ctx, packet)
 }
 
+// SendConsumer writes a consumer control packet to the bridge, with the same
+// delivery semantics as SendKeyboard.
 func (m *Manager) SendConsumer(ctx context.Context, usage uint16, release bool) error {
-	if m.currentPort() == nil {
-		return fmt.Errorf("keybridge not connected")
-	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -112,16 +194,46 @@ func (m *Manager) SendConsumer(ctx context.Context, usage uint16, release bool)
 		typeByte |= keybridgeReleaseFlag
 	}
 	packet := buildPacket(typeByte, usage, 0, 0)
+	if m.currentPort() == nil {
+		m.stats.addDropped(packet)
+		return &notSentError{ErrNotConnected}
+	}
 	return m.enqueuePacket(ctx, packet)
 }
 
+// writeRequest is a queued packet. The write worker reports the outcome of
+// the serial write on done.
+type writeRequest struct {
+	ctx      context.Context
+	packet   [keybridgePacketLen]byte
+	enqueued time.Time
+	done     chan error
+}
+
+// enqueuePacket queues the packet and waits until it has been written to the
+// bridge (or failed to be).
 func (m *Manager) enqueuePacket(ctx context.Context, packet [keybridgePacketLen]byte) error {
+	req := writeRequest{ctx: ctx, packet: packet, enqueued: time.Now(), done: make(chan error, 1)}
+	m.queued.Add(1)
+	defer m.queued.Add(-1)
 	select {
-	case m.writeCh <- packet:
-		return nil
+	case m.writeCh <- req:
+		m.stats.addEnqueued(packet)
 	case <-m.stopCh:
-		return fmt.Errorf("keybridge closed")
+		m.stats.addDropped(packet)
+		return &notSentError{ErrClosed}
 	case <-ctx.Done():
+		m.stats.addDropped(packet)
+		return &notSentError{fmt.Errorf("keybridge send canceled: %w", ctx.Err())}
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-m.stopCh:
+		return ErrClosed
+	case <-ctx.Done():
+		// The worker skips requests whose context is done, but the packet
+		// may be in the middle of being written.
 		return fmt.Errorf("keybridge send canceled: %w", ctx.Err())
 	}
 }
@@ -136,19 +248,36 @@ func buildPacket(typeByte byte, code uint16, modifier byte, flags byte) [keybrid
 	}
 }
 
+// Close releases any held keys, disconnects from the bridge and closes the
+// channels of log subscribers.
 func (m *Manager) Close() {
-	var port serial.Port
+	if m.currentPort() != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		if err := m.ReleaseAll(ctx); err != nil {
+			m.logger.Warn("failed to release held keys on close", "error", err)
+		}
+		cancel()
+	}
+
+	var port Transport
 	close(m.stopCh)
 	m.mu.Lock()
 	port = m.port
+	portName := m.portName
 	m.port = nil
 	m.portName = ""
+	m.portDetails = PortDetails{}
+	m.connectedAt = time.Time{}
 	m.mu.Unlock()
 
 	if port != nil {
 		_ = port.Close()
 	}
 	m.wg.Wait()
+	m.logs.close()
+	if port != nil {
+		m.notifyState(StateDisconnected, portName, ErrClosed)
+	}
 }
 
 func (m *Manager) deviceLogReadLoop() {
@@ -187,18 +316,32 @@ func (m *Manager) writeWorker() {
 		select {
 		case <-m.stopCh:
 			return
-		case packet := <-m.writeCh:
-			port := m.currentPort()
-			if port == nil {
-				continue
-			}
-			if err := m.writePacket(port, packet[:]); err != nil {
-				if !m.isStopped() {
-					m.logger.Warn("write failed", "error", err)
-				}
-			}
+		case req := <-m.writeCh:
+			req.done <- m.handleWrite(req)
+		}
+	}
+}
+
+func (m *Manager) handleWrite(req writeRequest) error {
+	if err := req.ctx.Err(); err != nil {
+		m.stats.addDropped(req.packet)
+		return fmt.Errorf("keybridge send canceled: %w", err)
+	}
+	port := m.currentPort()
+	if port == nil {
+		m.stats.addDropped(req.packet)
+		return ErrNotConnected
+	}
+	if err := m.writePacket(port, req.packet[:]); err != nil {
+		if !m.isStopped() {
+			m.logger.Warn("write failed", "error", err)
 		}
+		m.stats.addWriteError()
+		return err
 	}
+	m.stats.addWritten(req.packet, time.Since(req.enqueued))
+	m.trackWritten(req.packet)
+	return nil
 }
 
 func (m *Manager) reconnectLoop() {
@@ -222,11 +365,17 @@ func (m *Manager) reconnectLoop() {
 			}
 			continue
 		}
+		m.releaseOnReconnect()
 	}
 }
 
 func (m *Manager) handleConnectError(err error) {
-	if errors.Is(err, errDeviceNotFound) {
+	m.mu.Lock()
+	m.lastError = err
+	m.lastErrorTime = time.Now()
+	m.mu.Unlock()
+	// Not-found and ambiguous matches are logged by findPort when they change.
+	if errors.Is(err, errDeviceNotFound) || errors.Is(err, errAmbiguousPort) {
 		return
 	}
 	if m.shouldLogConnectError(err) {
@@ -252,13 +401,13 @@ func (m *Manager) isStopped() bool {
 	}
 }
 
-func (m *Manager) currentPort() serial.Port {
+func (m *Manager) currentPort() Transport {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.port
 }
 
-func (m *Manager) readLogs(port serial.Port) error {
+func (m *Manager) readLogs(port Transport) error {
 	state := logLineState{}
 	readBuf := make([]byte, 256)
 	for {
@@ -322,7 +471,7 @@ func (m *Manager) appendLogBytes(state *logLineState, data []byte) {
 }
 
 func (m *Manager) flushTruncatedLine(state *logLineState) {
-	m.logDeviceLine(state.buffer.Bytes())
+	m.logDeviceLine(state.buffer.Bytes(), true)
 	state.buffer.Reset()
 	if !state.truncated {
 		m.logger.Warn("device log line too long, truncated", "max_bytes", maxLogLineBytes)
@@ -331,11 +480,11 @@ func (m *Manager) flushTruncatedLine(state *logLineState) {
 }
 
 func (m *Manager) flushLogLine(state *logLineState) {
-	m.logDeviceLine(state.buffer.Bytes())
+	m.logDeviceLine(state.buffer.Bytes(), false)
 	state.buffer.Reset()
 }
 
-func (m *Manager) logDeviceLine(line []byte) {
+func (m *Manager) logDeviceLine(line []byte, truncated bool) {
 	if len(line) == 0 {
 		return
 	}
@@ -344,43 +493,69 @@ func (m *Manager) logDeviceLine(line []byte) {
 		return
 	}
 	m.logger.Info(text)
+	m.stats.addLogLine(truncated)
+	m.logs.publish(LogLine{Time: time.Now(), Text: text, Truncated: truncated})
 }
 
-func (m *Manager) writePacketWithTimeout(port serial.Port, packet []byte) error {
+func (m *Manager) writePacketWithTimeout(port Transport, packet []byte) error {
 	if _, err := port.Write(packet); err != nil {
 		m.disconnectWithLog(err)
-		return fmt.Errorf("device write failed: %w", err)
+		return fmt.Errorf("%w: device write failed: %w", ErrNotConnected, err)
 	}
 	return nil
 }
 
-func (m *Manager) findPort() (string, error) {
-	ports, err := enumerator.GetDetailedPortsList()
+func (m *Manager) findPort() (PortDetails, error) {
+	if m.selector.Path != "" {
+		return m.pathDetails(), nil
+	}
+
+	ports, err := m.dialer.ListPorts()
 	if err != nil {
-		return "", fmt.Errorf("enumerate serial ports: %w", err)
+		return PortDetails{}, fmt.Errorf("enumerate serial ports: %w", err)
 	}
 
-	expectedVID := fmt.Sprintf("%04X", m.vid)
-	expectedPID := fmt.Sprintf("%04X", m.pid)
+	var matches []PortDetails
 	for _, port := range ports {
-		if port == nil || !port.IsUSB {
-			continue
+		if m.selector.matches(port) {
+			matches = append(matches, port)
 		}
-		if !strings.EqualFold(port.VID, expectedVID) || !strings.EqualFold(port.PID, expectedPID) {
-			continue
+	}
+
+	if len(matches) > 1 {
+		names := make([]string, 0, len(matches))
+		for _, match := range matches {
+			names = append(names, match.Name)
+		}
+		candidates := strings.Join(names, ", ")
+		m.mu.Lock()
+		shouldLog := m.lastAmbiguous != candidates
+		m.lastAmbiguous = candidates
+		m.mu.Unlock()
+		if shouldLog {
+			m.logger.Warn("multiple USB serial adapters match, select one by path, serial number or product", "selector", m.selector.String(), "ports", candidates)
 		}
+		return PortDetails{}, fmt.Errorf("%w (%s): %s", errAmbiguousPort, m.selector, candidates)
+	}
+	m.mu.Lock()
+	m.lastAmbiguous = ""
+	m.mu.Unlock()
+
+	if len(matches) == 1 {
+		name := matches[0].Name
 		shouldLog := false
 		m.mu.Lock()
-		if !m.lastFound || m.lastFoundPort != port.Name {
+		if !m.lastFound || m.lastFoundPort != name {
 			shouldLog = true
 		}
 		m.lastFound = true
-		m.lastFoundPort = port.Name
+		m.lastFoundPort = name
 		m.mu.Unlock()
 		if shouldLog {
-			m.logger.Info("USB serial adapter found", "port", port.Name, "vid", fmt.Sprintf("0x%04X", m.vid), "pid", fmt.Sprintf("0x%04X", m.pid))
+			m.logger.Info("USB serial adapter found", "port", name, "selector", m.selector.String())
+			m.notifyState(StateFound, name, nil)
 		}
-		return port.Name, nil
+		return matches[0], nil
 	}
 
 	m.mu.Lock()
@@ -389,17 +564,32 @@ func (m *Manager) findPort() (string, error) {
 	m.lastFoundPort = ""
 	m.mu.Unlock()
 	if wasFound {
-		m.logger.Warn("USB serial adapter not found", "vid", fmt.Sprintf("0x%04X", m.vid), "pid", fmt.Sprintf("0x%04X", m.pid))
+		m.logger.Warn("USB serial adapter not found", "selector", m.selector.String())
+		m.notifyState(StateLost, "", nil)
 		m.resetOpenFailureLog()
 	}
-	return "", fmt.Errorf("%w (vid=0x%04X pid=0x%04X)", errDeviceNotFound, m.vid, m.pid)
+	return PortDetails{}, fmt.Errorf("%w (%s)", errDeviceNotFound, m.selector)
 }
 
-func (m *Manager) writePacket(port serial.Port, packet []byte) error {
+// pathDetails describes the port named by Selector.Path, with its USB
+// details if it is enumerated.
+func (m *Manager) pathDetails() PortDetails {
+	ports, err := m.dialer.ListPorts()
+	if err == nil {
+		for _, port := range ports {
+			if port.Name == m.selector.Path {
+				return port
+			}
+		}
+	}
+	return PortDetails{Name: m.selector.Path}
+}
+
+func (m *Manager) writePacket(port Transport, packet []byte) error {
 	m.mu.Lock()
 	if m.port == nil || m.port != port {
 		m.mu.Unlock()
-		return fmt.Errorf("keybridge port not connected")
+		return ErrNotConnected
 	}
 	m.mu.Unlock()
 	if len(packet) != keybridgePacketLen {
@@ -421,26 +611,29 @@ func (m *Manager) connect() error {
 		return nil
 	}
 
-	portName, err := m.findPort()
+	details, err := m.findPort()
 	if err != nil {
 		return err
 	}
-	port, err := m.openPortWithRetry(portName)
+	port, err := m.openPortWithRetry(details.Name)
 	if err != nil {
 		return err
 	}
-	m.setPort(port, portName)
-	m.logger.Info("connected", "port", portName)
+	if !m.setPort(port, details) {
+		return nil
+	}
+	m.logger.Info("connected", "port", details.Name)
+	m.notifyState(StateConnected, details.Name, nil)
 	m.resetOpenFailureLog()
 	return nil
 }
 
-func (m *Manager) openPortWithRetry(portName string) (serial.Port, error) {
+func (m *Manager) openPortWithRetry(portName string) (Transport, error) {
 	const maxAttempts = 5
 	delay := 150 * time.Millisecond
 	var lastErr error
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		port, err := serial.Open(portName, &serial.Mode{BaudRate: defaultBaudRate})
+		port, err := m.dialer.Dial(portName)
 		if err == nil {
 			return port, nil
 		}
@@ -457,16 +650,22 @@ func (m *Manager) openPortWithRetry(portName string) (serial.Port, error) {
 	)
 }
 
-func (m *Manager) setPort(port serial.Port, name string) {
+// setPort makes port the current connection. It returns false, closing
+// port, if the Manager has been closed.
+func (m *Manager) setPort(port Transport, details PortDetails) bool {
 	m.mu.Lock()
 	if m.isStopped() {
 		m.mu.Unlock()
 		_ = port.Close()
-		return
+		return false
 	}
 	m.port = port
-	m.portName = name
+	m.portName = details.Name
+	m.portDetails = details
+	m.connectedAt = time.Now()
+	m.connects++
 	m.mu.Unlock()
+	return true
 }
 
 func (m *Manager) disconnectWithLog(err error) {
@@ -474,15 +673,20 @@ func (m *Manager) disconnectWithLog(err error) {
 }
 
 func (m *Manager) disconnectWithOptions(err error, logError bool) {
-	var port serial.Port
+	var port Transport
 	m.mu.Lock()
 	if m.port == nil {
 		m.mu.Unlock()
 		return
 	}
 	port = m.port
+	portName := m.portName
 	m.port = nil
 	m.portName = ""
+	m.portDetails = PortDetails{}
+	m.connectedAt = time.Time{}
+	m.lastError = err
+	m.lastErrorTime = time.Now()
 	m.mu.Unlock()
 
 	if port != nil {
@@ -491,10 +695,12 @@ func (m *Manager) disconnectWithOptions(err error, logError bool) {
 	if logError && !m.isStopped() {
 		m.logger.Warn("disconnected", "error", err)
 	}
+	m.notifyState(StateDisconnected, portName, err)
 	m.resetOpenFailureLog()
 }
 
 func (m *Manager) logOpenFailure(portName string, err error, maxAttempts int) {
+	m.stats.addOpenFailure()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -0,0 +1,145 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+func newTestManager(t *testing.T, bridge *devicetest.Bridge, config device.Config) *device.Manager {
+	t.Helper()
+	config.Dialer = bridge
+	if config.Logger == nil {
+		config.Logger = slog.New(slog.DiscardHandler)
+	}
+	manager := device.NewManager(config)
+	t.Cleanup(manager.Close)
+	return manager
+}
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// waitFor polls cond until it holds or ctx is done.
+func waitFor(t *testing.T, ctx context.Context, what string, cond func() bool) {
+	t.Helper()
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", what)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func waitConnected(t *testing.T, ctx context.Context, manager *device.Manager, connected bool) {
+	t.Helper()
+	waitFor(t, ctx, "connection state", func() bool { return manager.Status().Connected == connected })
+}
+
+func TestManagerConnects(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{Name: "test"})
+
+	if err := bridge.WaitConnected(ctx); err != nil {
+		t.Fatalf("bridge not opened: %v", err)
+	}
+	waitConnected(t, ctx, manager, true)
+	status := manager.Status()
+	if status.Name != "test" || status.Port != devicetest.DefaultPortName {
+		t.Errorf("status = %+v, want name test on %s", status, devicetest.DefaultPortName)
+	}
+	if status.VID != device.DefaultVID || status.PID != device.DefaultPID {
+		t.Errorf("status VID:PID = %04X:%04X, want %04X:%04X", status.VID, status.PID, device.DefaultVID, device.DefaultPID)
+	}
+}
+
+func TestSendReturnsAfterWrite(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	if err := manager.SendKeyboard(ctx, 0x04, 0x02, device.KeyboardFlagAppleFn, false); err != nil {
+		t.Fatalf("SendKeyboard: %v", err)
+	}
+	if err := manager.SendConsumer(ctx, 0xCD, true); err != nil {
+		t.Fatalf("SendConsumer: %v", err)
+	}
+	// Sends only return once the packet was written, so it must already
+	// have reached the bridge.
+	want := []device.Packet{
+		{Type: device.PacketKeyboard, Code: 0x04, Modifier: 0x02, Flags: device.KeyboardFlagAppleFn},
+		{Type: device.PacketConsumer, Release: true, Code: 0xCD},
+	}
+	if got := bridge.Packets(); !slices.Equal(got, want) {
+		t.Errorf("packets = %v, want %v", got, want)
+	}
+}
+
+func TestSendAfterUnplug(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	bridge.Unplug()
+	waitConnected(t, ctx, manager, false)
+	if err := manager.SendKeyboard(ctx, 0x04, 0, 0, false); !errors.Is(err, device.ErrNotConnected) || !errors.Is(err, device.ErrNotSent) {
+		t.Errorf("SendKeyboard after unplug = %v, want ErrNotConnected and ErrNotSent", err)
+	}
+	if err := manager.SendConsumer(ctx, 0xCD, false); !errors.Is(err, device.ErrNotConnected) || !errors.Is(err, device.ErrNotSent) {
+		t.Errorf("SendConsumer after unplug = %v, want ErrNotConnected and ErrNotSent", err)
+	}
+	if err := manager.PressAndReleaseKeyboard(ctx, 0x04, 0, 0, 0); !errors.Is(err, device.ErrNotSent) {
+		t.Errorf("PressAndReleaseKeyboard after unplug = %v, want ErrNotSent", err)
+	}
+	if packets := bridge.Packets(); len(packets) != 0 {
+		t.Errorf("bridge received %v while unplugged", packets)
+	}
+}
+
+func TestReplugReleasesHeldKeys(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	if err := manager.SendKeyboard(ctx, 0x04, 0x02, 0, false); err != nil {
+		t.Fatalf("SendKeyboard: %v", err)
+	}
+	if err := manager.SendConsumer(ctx, 0xCD, false); err != nil {
+		t.Fatalf("SendConsumer: %v", err)
+	}
+	bridge.Unplug()
+	waitConnected(t, ctx, manager, false)
+	bridge.Reset()
+	bridge.Plug()
+
+	packets, err := bridge.WaitPackets(ctx, 2)
+	if err != nil {
+		t.Fatalf("held keys not released after replug, got %v: %v", packets, err)
+	}
+	slices.SortFunc(packets, func(a, b device.Packet) int { return int(a.Type) - int(b.Type) })
+	want := []device.Packet{
+		{Type: device.PacketKeyboard, Release: true, Code: 0x04, Modifier: 0x02},
+		{Type: device.PacketConsumer, Release: true, Code: 0xCD},
+	}
+	if !slices.Equal(packets, want) {
+		t.Errorf("packets after replug = %v, want %v", packets, want)
+	}
+	if opens := bridge.Opens(); opens != 2 {
+		t.Errorf("bridge opened %d times, want 2", opens)
+	}
+}
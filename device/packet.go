@@ -0,0 +1,71 @@
+package device
+
+import "fmt"
+
+// PacketLen is the size of a keybridge wire packet.
+const PacketLen = keybridgePacketLen
+
+// PacketType selects the HID usage page a packet's code belongs to.
+type PacketType byte
+
+const (
+	PacketKeyboard PacketType = keybridgeTypeKeyboard
+	PacketConsumer PacketType = keybridgeTypeConsumer
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case PacketKeyboard:
+		return "keyboard"
+	case PacketConsumer:
+		return "consumer"
+	default:
+		return fmt.Sprintf("0x%02X", byte(t))
+	}
+}
+
+// Packet is the decoded form of the 5-byte packet sent to the bridge:
+//
+//	[type|release] [code lo] [code hi] [modifier] [flags]
+type Packet struct {
+	Type     PacketType
+	Release  bool
+	Code     uint16
+	Modifier byte
+	Flags    byte
+}
+
+// Encode returns the wire representation of the packet.
+func (p Packet) Encode() [PacketLen]byte {
+	typeByte := byte(p.Type)
+	if p.Release {
+		typeByte |= keybridgeReleaseFlag
+	}
+	return buildPacket(typeByte, p.Code, p.Modifier, p.Flags)
+}
+
+func (p Packet) String() string {
+	action := "press"
+	if p.Release {
+		action = "release"
+	}
+	return fmt.Sprintf("%s %s code=0x%04X modifier=0x%02X flags=0x%02X", p.Type, action, p.Code, p.Modifier, p.Flags)
+}
+
+// DecodePacket parses a wire packet produced by the Manager.
+func DecodePacket(data []byte) (Packet, error) {
+	if len(data) != keybridgePacketLen {
+		return Packet{}, fmt.Errorf("invalid keybridge packet length: %d", len(data))
+	}
+	packetType := PacketType(data[0] &^ keybridgeReleaseFlag)
+	if packetType != PacketKeyboard && packetType != PacketConsumer {
+		return Packet{}, fmt.Errorf("invalid keybridge packet type: 0x%02X", data[0])
+	}
+	return Packet{
+		Type:     packetType,
+		Release:  data[0]&keybridgeReleaseFlag != 0,
+		Code:     uint16(data[1]) | uint16(data[2])<<8,
+		Modifier: data[3],
+		Flags:    data[4],
+	}, nil
+}
@@ -0,0 +1,73 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Selector chooses which serial port a Manager drives.
+//
+// If Path is set, that device is opened directly and discovery is skipped.
+// Otherwise ports are matched by VID/PID (zero values default to
+// DefaultVID/DefaultPID), optionally narrowed down by SerialNumber and
+// Product so that several identical bridges can be told apart.
+type Selector struct {
+	VID  uint16
+	PID  uint16
+	Path string
+	// SerialNumber must match the USB serial number exactly (case-insensitive).
+	SerialNumber string
+	// Product must be contained in the OS-reported product string
+	// (case-insensitive).
+	Product string
+}
+
+// Validate reports selectors combining an explicit path with discovery filters.
+func (s Selector) Validate() error {
+	if s.Path != "" && (s.SerialNumber != "" || s.Product != "") {
+		return errors.New("device path cannot be combined with serial number or product selectors")
+	}
+	return nil
+}
+
+func (s Selector) withDefaults() Selector {
+	if s.VID == 0 {
+		s.VID = DefaultVID
+	}
+	if s.PID == 0 {
+		s.PID = DefaultPID
+	}
+	return s
+}
+
+func (s Selector) String() string {
+	if s.Path != "" {
+		return "path=" + s.Path
+	}
+	s = s.withDefaults()
+	parts := []string{fmt.Sprintf("vid=0x%04X", s.VID), fmt.Sprintf("pid=0x%04X", s.PID)}
+	if s.SerialNumber != "" {
+		parts = append(parts, fmt.Sprintf("serial=%q", s.SerialNumber))
+	}
+	if s.Product != "" {
+		parts = append(parts, fmt.Sprintf("product=%q", s.Product))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s Selector) matches(port PortDetails) bool {
+	if !port.IsUSB {
+		return false
+	}
+	if !strings.EqualFold(port.VID, fmt.Sprintf("%04X", s.VID)) || !strings.EqualFold(port.PID, fmt.Sprintf("%04X", s.PID)) {
+		return false
+	}
+	if s.SerialNumber != "" && !strings.EqualFold(port.SerialNumber, s.SerialNumber) {
+		return false
+	}
+	if s.Product != "" && !strings.Contains(strings.ToLower(port.Product), strings.ToLower(s.Product)) {
+		return false
+	}
+	return true
+}
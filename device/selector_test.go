@@ -0,0 +1,128 @@
+package device_test
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+// usbBridge returns a fake bridge with the default VID/PID on port name.
+func usbBridge(name, serial, product string) *devicetest.Bridge {
+	return devicetest.NewBridge(devicetest.Config{Port: device.PortDetails{
+		Name:         name,
+		IsUSB:        true,
+		VID:          fmt.Sprintf("%04X", device.DefaultVID),
+		PID:          fmt.Sprintf("%04X", device.DefaultPID),
+		SerialNumber: serial,
+		Product:      product,
+	}})
+}
+
+func newRecordedManager(t *testing.T, dialer device.Dialer, selector device.Selector) (*device.Manager, *stateRecorder) {
+	t.Helper()
+	recorder := &stateRecorder{}
+	manager := device.NewManager(device.Config{
+		Dialer:        dialer,
+		Selector:      selector,
+		Logger:        slog.New(slog.DiscardHandler),
+		OnStateChange: recorder.record,
+	})
+	t.Cleanup(manager.Close)
+	return manager, recorder
+}
+
+func waitLastError(t *testing.T, manager *device.Manager, contains string) {
+	t.Helper()
+	waitFor(t, testContext(t), "connect error", func() bool {
+		err := manager.Status().LastError
+		return err != nil && strings.Contains(err.Error(), contains)
+	})
+}
+
+func TestAmbiguousPorts(t *testing.T) {
+	ctx := testContext(t)
+	first := usbBridge("/dev/ttyACM0", "AAA", "Keybridge")
+	second := usbBridge("/dev/ttyACM1", "BBB", "Keybridge")
+	manager, recorder := newRecordedManager(t, devicetest.Ports{first, second}, device.Selector{})
+
+	waitLastError(t, manager, "multiple USB serial adapters match")
+	if err := manager.Status().LastError.Error(); !strings.Contains(err, "/dev/ttyACM0, /dev/ttyACM1") {
+		t.Errorf("error %q doesn't list the candidates", err)
+	}
+	if first.Opens() != 0 || second.Opens() != 0 {
+		t.Error("an ambiguous port was opened")
+	}
+	if states := recorder.states(); len(states) != 0 {
+		t.Errorf("states = %v, want none while ambiguous", states)
+	}
+
+	// Unplugging one of them resolves the ambiguity.
+	first.Unplug()
+	waitConnected(t, ctx, manager, true)
+	if port := manager.Status().Port; port != "/dev/ttyACM1" {
+		t.Errorf("connected to %s, want /dev/ttyACM1", port)
+	}
+	if got, want := recorder.states(), []device.State{device.StateFound, device.StateConnected}; !slices.Equal(got, want) {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+}
+
+func TestNoMatchingPort(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{Unplugged: true})
+	manager, recorder := newRecordedManager(t, bridge, device.Selector{})
+
+	waitLastError(t, manager, "USB serial adapter not found")
+	if states := recorder.states(); len(states) != 0 {
+		t.Errorf("states = %v, want none before the adapter is found", states)
+	}
+
+	bridge.Plug()
+	waitConnected(t, ctx, manager, true)
+	bridge.Unplug()
+	waitFor(t, ctx, "lost", func() bool { return len(recorder.states()) >= 4 })
+	want := []device.State{device.StateFound, device.StateConnected, device.StateDisconnected, device.StateLost}
+	if got := recorder.states(); !slices.Equal(got, want) {
+		t.Errorf("states = %v, want %v", got, want)
+	}
+	if last := recorder.last(); last.Port != "" {
+		t.Errorf("lost change has port %q, want none", last.Port)
+	}
+}
+
+func TestSelectBySerialAndProduct(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector device.Selector
+		want     string
+	}{
+		{"serial", device.Selector{SerialNumber: "bbb"}, "/dev/ttyACM1"},
+		{"product", device.Selector{Product: "nordic"}, "/dev/ttyACM0"},
+		{"serial and product", device.Selector{SerialNumber: "AAA", Product: "Nordic BT"}, "/dev/ttyACM0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ports := devicetest.Ports{
+				usbBridge("/dev/ttyACM0", "AAA", "Nordic BT KeyBridge"),
+				usbBridge("/dev/ttyACM1", "BBB", "Pico KeyBridge"),
+			}
+			manager, recorder := newRecordedManager(t, ports, test.selector)
+			waitConnected(t, testContext(t), manager, true)
+			if port := manager.Status().Port; port != test.want {
+				t.Errorf("connected to %s, want %s", port, test.want)
+			}
+			if found := recorder.at(0); found.State != device.StateFound || found.Port != test.want {
+				t.Errorf("first change = %+v, want found on %s", found, test.want)
+			}
+		})
+	}
+
+	ports := devicetest.Ports{usbBridge("/dev/ttyACM0", "AAA", "Nordic BT KeyBridge")}
+	manager, _ := newRecordedManager(t, ports, device.Selector{SerialNumber: "CCC"})
+	waitLastError(t, manager, `serial="CCC"`)
+}
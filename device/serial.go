@@ -0,0 +1,174 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Parity is the parity setting of the serial port.
+type Parity byte
+
+const (
+	ParityNone Parity = iota
+	ParityOdd
+	ParityEven
+	ParityMark
+	ParitySpace
+)
+
+var parityNames = []string{"none", "odd", "even", "mark", "space"}
+
+func (p Parity) String() string {
+	if int(p) < len(parityNames) {
+		return parityNames[p]
+	}
+	return fmt.Sprintf("Parity(%d)", byte(p))
+}
+
+// ParseParity parses "none", "odd", "even", "mark" or "space".
+func ParseParity(value string) (Parity, error) {
+	for i, name := range parityNames {
+		if strings.EqualFold(value, name) {
+			return Parity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid parity %q (expected none, odd, even, mark or space)", value)
+}
+
+// StopBits is the number of stop bits of the serial port.
+type StopBits byte
+
+const (
+	StopBits1 StopBits = iota
+	StopBits1Half
+	StopBits2
+)
+
+var stopBitsNames = []string{"1", "1.5", "2"}
+
+func (s StopBits) String() string {
+	if int(s) < len(stopBitsNames) {
+		return stopBitsNames[s]
+	}
+	return fmt.Sprintf("StopBits(%d)", byte(s))
+}
+
+// ParseStopBits parses "1", "1.5" or "2".
+func ParseStopBits(value string) (StopBits, error) {
+	for i, name := range stopBitsNames {
+		if value == name {
+			return StopBits(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid stop bits %q (expected 1, 1.5 or 2)", value)
+}
+
+// Line is the state of a modem control line (DTR or RTS). The zero value
+// asserts the line, as serial ports are usually opened.
+type Line byte
+
+const (
+	LineOn Line = iota
+	LineOff
+)
+
+func (l Line) String() string {
+	if l == LineOff {
+		return "off"
+	}
+	return "on"
+}
+
+// ParseLine parses "on"/"off" (or "true"/"false", "1"/"0", "high"/"low").
+func ParseLine(value string) (Line, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "1", "high":
+		return LineOn, nil
+	case "off", "false", "0", "low":
+		return LineOff, nil
+	}
+	return 0, fmt.Errorf("invalid line state %q (expected on or off)", value)
+}
+
+// SerialMode is how the default Dialer opens serial ports. The zero value
+// is DefaultBaudRate 8N1 with DTR and RTS asserted.
+type SerialMode struct {
+	BaudRate int
+	// DataBits is 5 to 8, zero for DefaultDataBits.
+	DataBits int
+	Parity   Parity
+	StopBits StopBits
+	// DTR and RTS are the control line states once the port is open.
+	DTR Line
+	RTS Line
+	// Pulse, if set, opens the port with DTR and RTS inverted and only sets
+	// them after Pulse has elapsed. Bridges that reset on a control line
+	// edge are thereby reset on every connect.
+	Pulse time.Duration
+}
+
+// Validate reports out of range settings.
+func (m SerialMode) Validate() error {
+	if m.BaudRate < 0 {
+		return errors.New("baud rate must be positive")
+	}
+	if m.DataBits != 0 && (m.DataBits < 5 || m.DataBits > 8) {
+		return fmt.Errorf("invalid data bits %d (expected 5 to 8)", m.DataBits)
+	}
+	if int(m.Parity) >= len(parityNames) {
+		return fmt.Errorf("invalid parity %s", m.Parity)
+	}
+	if int(m.StopBits) >= len(stopBitsNames) {
+		return fmt.Errorf("invalid stop bits %s", m.StopBits)
+	}
+	if m.Pulse < 0 {
+		return errors.New("pulse must not be negative")
+	}
+	return nil
+}
+
+func (m SerialMode) withDefaults() SerialMode {
+	if m.BaudRate <= 0 {
+		m.BaudRate = DefaultBaudRate
+	}
+	if m.DataBits == 0 {
+		m.DataBits = DefaultDataBits
+	}
+	return m
+}
+
+// String formats the mode as e.g. "115200 8N1 dtr=on rts=on".
+func (m SerialMode) String() string {
+	m = m.withDefaults()
+	s := fmt.Sprintf("%d %d%s%s dtr=%s rts=%s", m.BaudRate, m.DataBits, strings.ToUpper(m.Parity.String()[:1]), m.StopBits, m.DTR, m.RTS)
+	if m.Pulse > 0 {
+		s += " pulse=" + m.Pulse.String()
+	}
+	return s
+}
+
+func (m SerialMode) serialMode(dtr, rts Line) *serial.Mode {
+	mode := &serial.Mode{
+		BaudRate: m.BaudRate,
+		DataBits: m.DataBits,
+		Parity:   serial.Parity(m.Parity),
+		StopBits: serial.StopBits(m.StopBits),
+	}
+	// Leave the lines alone unless one must be off: ports opened by the OS
+	// already assert them, and some (ptys) reject modem control ioctls.
+	if dtr == LineOff || rts == LineOff {
+		mode.InitialStatusBits = &serial.ModemOutputBits{DTR: dtr == LineOn, RTS: rts == LineOn}
+	}
+	return mode
+}
+
+func (l Line) inverted() Line {
+	if l == LineOn {
+		return LineOff
+	}
+	return LineOn
+}
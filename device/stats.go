@@ -0,0 +1,162 @@
+package device
+
+import (
+	"sync"
+	"time"
+)
+
+// WriteLatencyBuckets are the upper bounds, in seconds, of the
+// Stats.WriteLatency buckets.
+var WriteLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Histogram is a snapshot of observed durations, in seconds.
+type Histogram struct {
+	// Buckets holds the upper bounds, as in WriteLatencyBuckets.
+	Buckets []float64
+	// Counts[i] is the number of observations less than or equal to
+	// Buckets[i] (cumulative, as in Prometheus histograms).
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// Stats holds counters accumulated since the Manager was created, plus the
+// current connection state.
+type Stats struct {
+	// Enqueued counts packets queued for writing, by type.
+	Enqueued map[PacketType]uint64
+	// Written counts packets written to the bridge, by type.
+	Written map[PacketType]uint64
+	// Dropped counts packets not written because the bridge wasn't
+	// connected, the send was canceled or the Manager was closed, by type.
+	Dropped map[PacketType]uint64
+	// WriteErrors counts failed writes to the serial port.
+	WriteErrors uint64
+	// Connects counts connections established.
+	Connects uint64
+	// OpenFailures counts failed attempts to open the serial port.
+	OpenFailures uint64
+	// LogLines counts device log lines read; LogTruncations counts the
+	// ones split because they exceeded the maximum line length.
+	LogLines       uint64
+	LogTruncations uint64
+
+	Connected  bool
+	QueueDepth int
+	// WriteLatency measures the time from enqueueing a packet until it has
+	// been written.
+	WriteLatency Histogram
+}
+
+// managerStats accumulates the counters reported by Manager.Stats.
+type managerStats struct {
+	mu             sync.Mutex
+	enqueued       map[PacketType]uint64
+	written        map[PacketType]uint64
+	dropped        map[PacketType]uint64
+	writeErrors    uint64
+	openFailures   uint64
+	logLines       uint64
+	logTruncations uint64
+	latencyCounts  []uint64
+	latencyCount   uint64
+	latencySum     float64
+}
+
+func newManagerStats() *managerStats {
+	return &managerStats{
+		enqueued:      make(map[PacketType]uint64),
+		written:       make(map[PacketType]uint64),
+		dropped:       make(map[PacketType]uint64),
+		latencyCounts: make([]uint64, len(WriteLatencyBuckets)),
+	}
+}
+
+// packetType returns the type of an encoded packet.
+func packetType(packet [keybridgePacketLen]byte) PacketType {
+	return PacketType(packet[0] &^ keybridgeReleaseFlag)
+}
+
+func (s *managerStats) addEnqueued(packet [keybridgePacketLen]byte) {
+	s.mu.Lock()
+	s.enqueued[packetType(packet)]++
+	s.mu.Unlock()
+}
+
+func (s *managerStats) addDropped(packet [keybridgePacketLen]byte) {
+	s.mu.Lock()
+	s.dropped[packetType(packet)]++
+	s.mu.Unlock()
+}
+
+func (s *managerStats) addWritten(packet [keybridgePacketLen]byte, latency time.Duration) {
+	seconds := latency.Seconds()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written[packetType(packet)]++
+	for i, bound := range WriteLatencyBuckets {
+		if seconds <= bound {
+			s.latencyCounts[i]++
+		}
+	}
+	s.latencyCount++
+	s.latencySum += seconds
+}
+
+func (s *managerStats) addWriteError() {
+	s.mu.Lock()
+	s.writeErrors++
+	s.mu.Unlock()
+}
+
+func (s *managerStats) addOpenFailure() {
+	s.mu.Lock()
+	s.openFailures++
+	s.mu.Unlock()
+}
+
+func (s *managerStats) addLogLine(truncated bool) {
+	s.mu.Lock()
+	s.logLines++
+	if truncated {
+		s.logTruncations++
+	}
+	s.mu.Unlock()
+}
+
+// Stats returns the Manager's counters and current connection state.
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	stats := Stats{
+		Connects:   uint64(m.connects),
+		Connected:  m.port != nil,
+		QueueDepth: int(m.queued.Load()),
+	}
+	m.mu.Unlock()
+
+	s := m.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.Enqueued = copyCounts(s.enqueued)
+	stats.Written = copyCounts(s.written)
+	stats.Dropped = copyCounts(s.dropped)
+	stats.WriteErrors = s.writeErrors
+	stats.OpenFailures = s.openFailures
+	stats.LogLines = s.logLines
+	stats.LogTruncations = s.logTruncations
+	stats.WriteLatency = Histogram{
+		Buckets: WriteLatencyBuckets,
+		Counts:  append([]uint64(nil), s.latencyCounts...),
+		Count:   s.latencyCount,
+		Sum:     s.latencySum,
+	}
+	return stats
+}
+
+func copyCounts(counts map[PacketType]uint64) map[PacketType]uint64 {
+	copied := make(map[PacketType]uint64, len(counts))
+	for packetType, count := range counts {
+		copied[packetType] = count
+	}
+	return copied
+}
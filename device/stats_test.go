@@ -0,0 +1,80 @@
+package device_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+func TestStatsCountPackets(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, ctx, manager, true)
+
+	if err := manager.PressAndReleaseKeyboard(ctx, 0x04, 0, 0, 0); err != nil {
+		t.Fatalf("PressAndReleaseKeyboard: %v", err)
+	}
+	if err := manager.SendConsumer(ctx, 0xCD, false); err != nil {
+		t.Fatalf("SendConsumer: %v", err)
+	}
+	bridge.Unplug()
+	waitConnected(t, ctx, manager, false)
+	if err := manager.SendKeyboard(ctx, 0x05, 0, 0, false); !errors.Is(err, device.ErrNotConnected) {
+		t.Fatalf("SendKeyboard while unplugged = %v, want ErrNotConnected", err)
+	}
+
+	stats := manager.Stats()
+	if got := stats.Enqueued[device.PacketKeyboard]; got != 2 {
+		t.Errorf("enqueued keyboard = %d, want 2", got)
+	}
+	if got := stats.Written[device.PacketKeyboard]; got != 2 {
+		t.Errorf("written keyboard = %d, want 2", got)
+	}
+	if got := stats.Written[device.PacketConsumer]; got != 1 {
+		t.Errorf("written consumer = %d, want 1", got)
+	}
+	if got := stats.Dropped[device.PacketKeyboard]; got != 1 {
+		t.Errorf("dropped keyboard = %d, want 1", got)
+	}
+	if stats.Connects != 1 || stats.Connected {
+		t.Errorf("connects = %d, connected = %v, want 1 and false", stats.Connects, stats.Connected)
+	}
+	if stats.WriteLatency.Count != 3 || len(stats.WriteLatency.Counts) != len(device.WriteLatencyBuckets) {
+		t.Errorf("write latency = %+v, want 3 observations in %d buckets", stats.WriteLatency, len(device.WriteLatencyBuckets))
+	}
+	last := stats.WriteLatency.Counts[len(stats.WriteLatency.Counts)-1]
+	if last > stats.WriteLatency.Count {
+		t.Errorf("cumulative bucket count %d exceeds total %d", last, stats.WriteLatency.Count)
+	}
+}
+
+func TestStatsCountOpenFailures(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	bridge.SetOpenError(errors.New("permission denied"))
+	manager := newTestManager(t, bridge, device.Config{})
+
+	waitFor(t, ctx, "open failures", func() bool { return manager.Stats().OpenFailures >= 2 })
+	bridge.SetOpenError(nil)
+	waitConnected(t, ctx, manager, true)
+	if stats := manager.Stats(); stats.Connects != 1 {
+		t.Errorf("connects = %d, want 1", stats.Connects)
+	}
+}
+
+func TestStatsCountLogLines(t *testing.T) {
+	bridge := devicetest.NewBridge(devicetest.Config{Banner: []string{"boot"}})
+	manager := newTestManager(t, bridge, device.Config{})
+	waitConnected(t, testContext(t), manager, true)
+
+	bridge.Log(strings.Repeat("x", 20000))
+	waitLogs(t, manager, 3)
+	stats := manager.Stats()
+	if stats.LogLines != 3 || stats.LogTruncations != 1 {
+		t.Errorf("log lines = %d, truncations = %d, want 3 and 1", stats.LogLines, stats.LogTruncations)
+	}
+}
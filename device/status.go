@@ -0,0 +1,73 @@
+package device
+
+import (
+	"strconv"
+	"time"
+)
+
+// Status is a point-in-time snapshot of a Manager's connection.
+type Status struct {
+	Name      string
+	Selector  Selector
+	Connected bool
+	// Port is the name of the open serial port, empty while disconnected.
+	Port string
+	// VID and PID identify the USB serial adapter of the open port. They are
+	// zero while disconnected, or if the port isn't a USB device.
+	VID uint16
+	PID uint16
+	// ConnectedAt is when the current connection was established, zero
+	// while disconnected.
+	ConnectedAt time.Time
+	// Reconnects counts connections established after the first one.
+	Reconnects int
+	// LastError is the most recent connect or I/O error, kept after the
+	// bridge reconnects. LastErrorTime is when it happened.
+	LastError     error
+	LastErrorTime time.Time
+	// QueueDepth is the number of packets waiting to be written, including
+	// those of senders still waiting for room in the write queue.
+	QueueDepth int
+	// Serial is the mode the default Dialer opens the port with.
+	Serial SerialMode
+}
+
+// Name returns the bridge name from Config.
+func (m *Manager) Name() string {
+	return m.name
+}
+
+// Status returns the current connection state.
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := Status{
+		Name:          m.name,
+		Selector:      m.selector,
+		Connected:     m.port != nil,
+		Port:          m.portName,
+		ConnectedAt:   m.connectedAt,
+		LastError:     m.lastError,
+		LastErrorTime: m.lastErrorTime,
+		QueueDepth:    int(m.queued.Load()),
+		Serial:        m.serial,
+	}
+	if m.port != nil && m.portDetails.IsUSB {
+		status.VID = parseHexID(m.portDetails.VID)
+		status.PID = parseHexID(m.portDetails.PID)
+	}
+	if m.connects > 1 {
+		status.Reconnects = m.connects - 1
+	}
+	return status
+}
+
+// parseHexID parses a USB ID as reported by the enumerator ("1915"),
+// returning zero if it is malformed.
+func parseHexID(value string) uint16 {
+	id, err := strconv.ParseUint(value, 16, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(id)
+}
@@ -0,0 +1,106 @@
+package device_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/2opremio/keybridged/device"
+	"github.com/2opremio/keybridged/device/devicetest"
+)
+
+func TestStatusTracksReconnects(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	manager := newTestManager(t, bridge, device.Config{Name: "ipad"})
+	waitConnected(t, ctx, manager, true)
+
+	status := manager.Status()
+	if status.ConnectedAt.IsZero() || status.Reconnects != 0 || status.LastError != nil {
+		t.Errorf("first connection status = %+v, want connected with no reconnects or error", status)
+	}
+
+	bridge.Unplug()
+	waitConnected(t, ctx, manager, false)
+	status = manager.Status()
+	if status.Port != "" || status.VID != 0 || !status.ConnectedAt.IsZero() {
+		t.Errorf("disconnected status = %+v, want no port details", status)
+	}
+	if status.LastError == nil || status.LastErrorTime.IsZero() {
+		t.Error("disconnected status has no LastError")
+	}
+
+	bridge.Plug()
+	waitConnected(t, ctx, manager, true)
+	status = manager.Status()
+	if status.Reconnects != 1 || status.Port != devicetest.DefaultPortName {
+		t.Errorf("reconnected status = %+v, want 1 reconnect on %s", status, devicetest.DefaultPortName)
+	}
+	// The last error is kept after reconnecting.
+	if status.LastError == nil {
+		t.Error("reconnected status lost LastError")
+	}
+}
+
+func TestStatusPath(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{Port: device.PortDetails{Name: "/dev/ttyACM3"}})
+	manager := newTestManager(t, bridge, device.Config{Selector: device.Selector{Path: "/dev/ttyACM3"}})
+	waitConnected(t, ctx, manager, true)
+
+	status := manager.Status()
+	if status.Port != "/dev/ttyACM3" || status.Selector.Path != "/dev/ttyACM3" {
+		t.Errorf("status = %+v, want port /dev/ttyACM3", status)
+	}
+}
+
+// gatedDialer holds every write to the bridge until gate is closed.
+type gatedDialer struct {
+	*devicetest.Bridge
+	gate chan struct{}
+}
+
+func (d gatedDialer) Dial(name string) (device.Transport, error) {
+	transport, err := d.Bridge.Dial(name)
+	if err != nil {
+		return nil, err
+	}
+	return gatedTransport{Transport: transport, gate: d.gate}, nil
+}
+
+type gatedTransport struct {
+	device.Transport
+	gate chan struct{}
+}
+
+func (t gatedTransport) Write(p []byte) (int, error) {
+	<-t.gate
+	return t.Transport.Write(p)
+}
+
+func TestStatusQueueDepth(t *testing.T) {
+	ctx := testContext(t)
+	bridge := devicetest.NewBridge(devicetest.Config{})
+	gate := make(chan struct{})
+	manager := device.NewManager(device.Config{Dialer: gatedDialer{Bridge: bridge, gate: gate}})
+	defer manager.Close()
+	waitConnected(t, ctx, manager, true)
+
+	const senders = 3
+	var wg sync.WaitGroup
+	for i := range senders {
+		wg.Go(func() {
+			if err := manager.SendKeyboard(ctx, 0x04+uint16(i), 0, 0, false); err != nil {
+				t.Errorf("SendKeyboard: %v", err)
+			}
+		})
+	}
+	waitFor(t, ctx, "queued packets", func() bool { return manager.Status().QueueDepth == senders })
+	if depth := manager.Stats().QueueDepth; depth != senders {
+		t.Errorf("Stats().QueueDepth = %d, want %d", depth, senders)
+	}
+	close(gate)
+	wg.Wait()
+	if depth := manager.Status().QueueDepth; depth != 0 {
+		t.Errorf("QueueDepth after the writes = %d, want 0", depth)
+	}
+}
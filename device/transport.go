@@ -0,0 +1,86 @@
+package device
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+// Transport is an open connection to a bridge's serial transport.
+// Read returns device log output; Write carries keybridge packets.
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// PortDetails describes a serial port found during discovery.
+// It mirrors enumerator.PortDetails so alternative dialers don't need to
+// depend on go.bug.st/serial.
+type PortDetails struct {
+	Name         string
+	IsUSB        bool
+	VID          string
+	PID          string
+	SerialNumber string
+	Product      string
+}
+
+// Dialer discovers and opens bridge transports.
+//
+// The default dialer uses go.bug.st/serial. Tests can plug in an in-memory
+// implementation such as devicetest.Bridge to run the Manager without hardware.
+type Dialer interface {
+	// ListPorts returns the ports currently available for discovery.
+	ListPorts() ([]PortDetails, error)
+	// Dial opens the port with the given name.
+	Dial(name string) (Transport, error)
+}
+
+// serialDialer opens ports with go.bug.st/serial.
+type serialDialer struct {
+	mode SerialMode
+}
+
+func (serialDialer) ListPorts() ([]PortDetails, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, err
+	}
+	details := make([]PortDetails, 0, len(ports))
+	for _, port := range ports {
+		if port == nil {
+			continue
+		}
+		details = append(details, PortDetails{
+			Name:         port.Name,
+			IsUSB:        port.IsUSB,
+			VID:          port.VID,
+			PID:          port.PID,
+			SerialNumber: port.SerialNumber,
+			Product:      port.Product,
+		})
+	}
+	return details, nil
+}
+
+func (d serialDialer) Dial(name string) (Transport, error) {
+	if d.mode.Pulse <= 0 {
+		return serial.Open(name, d.mode.serialMode(d.mode.DTR, d.mode.RTS))
+	}
+	port, err := serial.Open(name, d.mode.serialMode(d.mode.DTR.inverted(), d.mode.RTS.inverted()))
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(d.mode.Pulse)
+	if err := port.SetDTR(d.mode.DTR == LineOn); err != nil {
+		_ = port.Close()
+		return nil, fmt.Errorf("set DTR: %w", err)
+	}
+	if err := port.SetRTS(d.mode.RTS == LineOn); err != nil {
+		_ = port.Close()
+		return nil, fmt.Errorf("set RTS: %w", err)
+	}
+	return port, nil
+}
@@ -0,0 +1,10 @@
+#!/usr/bin/env bash
+set -euo pipefail
+
+HOST="${HOST:-http://localhost:9876}"
+LAYOUT="${LAYOUT:-us}"
+
+# "Hello world!" in a single request; the daemon maps each character to HID codes.
+curl -sS -X POST "${HOST}/type" \
+  -H "Content-Type: application/json" \
+  -d "{\"text\":\"Hello world!\",\"layout\":\"${LAYOUT}\"}"
@@ -0,0 +1,41 @@
+// Package hid holds the USB HID usages and modifier bits understood by the
+// keybridge firmwares, plus keyboard layout tables for turning text into
+// keystrokes.
+package hid
+
+// Keyboard modifier bits, as carried in the modifier byte of keyboard packets.
+const (
+	ModLeftCtrl   byte = 0x01
+	ModLeftShift  byte = 0x02
+	ModLeftAlt    byte = 0x04
+	ModLeftGUI    byte = 0x08
+	ModRightCtrl  byte = 0x10
+	ModRightShift byte = 0x20
+	ModRightAlt   byte = 0x40
+	ModRightGUI   byte = 0x80
+)
+
+// Keyboard/Keypad page usages used by the layout tables.
+const (
+	KeyA              uint16 = 0x04
+	Key1              uint16 = 0x1E
+	Key0              uint16 = 0x27
+	KeyEnter          uint16 = 0x28
+	KeyEscape         uint16 = 0x29
+	KeyBackspace      uint16 = 0x2A
+	KeyTab            uint16 = 0x2B
+	KeySpace          uint16 = 0x2C
+	KeyMinus          uint16 = 0x2D
+	KeyEqual          uint16 = 0x2E
+	KeyLeftBrace      uint16 = 0x2F
+	KeyRightBrace     uint16 = 0x30
+	KeyBackslash      uint16 = 0x31
+	KeyNonUSHash      uint16 = 0x32
+	KeySemicolon      uint16 = 0x33
+	KeyApostrophe     uint16 = 0x34
+	KeyGrave          uint16 = 0x35
+	KeyComma          uint16 = 0x36
+	KeyDot            uint16 = 0x37
+	KeySlash          uint16 = 0x38
+	KeyNonUSBackslash uint16 = 0x64
+)
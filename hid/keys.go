@@ -0,0 +1,277 @@
+package hid
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chord is a parsed shortcut such as "cmd+shift+4" or "media:playpause".
+type Chord struct {
+	// Consumer selects the Consumer Page (0x0C); otherwise Code is a
+	// Keyboard/Keypad usage.
+	Consumer bool
+	// Code is the usage, or 0 for a modifier-only keyboard chord.
+	Code      uint16
+	Modifiers byte
+	AppleFn   bool
+}
+
+// consumerPrefixes introduce a consumer control in a chord string.
+var consumerPrefixes = []string{"media:", "consumer:"}
+
+// modifierNames maps modifier names to their bits. Unprefixed names select
+// the left-hand modifier.
+var modifierNames = map[string]byte{
+	"ctrl":        ModLeftCtrl,
+	"control":     ModLeftCtrl,
+	"shift":       ModLeftShift,
+	"alt":         ModLeftAlt,
+	"opt":         ModLeftAlt,
+	"option":      ModLeftAlt,
+	"cmd":         ModLeftGUI,
+	"command":     ModLeftGUI,
+	"gui":         ModLeftGUI,
+	"win":         ModLeftGUI,
+	"super":       ModLeftGUI,
+	"meta":        ModLeftGUI,
+	"lctrl":       ModLeftCtrl,
+	"lshift":      ModLeftShift,
+	"lalt":        ModLeftAlt,
+	"lcmd":        ModLeftGUI,
+	"lgui":        ModLeftGUI,
+	"left_ctrl":   ModLeftCtrl,
+	"left_shift":  ModLeftShift,
+	"left_alt":    ModLeftAlt,
+	"left_gui":    ModLeftGUI,
+	"rctrl":       ModRightCtrl,
+	"rshift":      ModRightShift,
+	"ralt":        ModRightAlt,
+	"altgr":       ModRightAlt,
+	"rcmd":        ModRightGUI,
+	"rgui":        ModRightGUI,
+	"right_ctrl":  ModRightCtrl,
+	"right_shift": ModRightShift,
+	"right_alt":   ModRightAlt,
+	"right_gui":   ModRightGUI,
+}
+
+// fnNames select the Apple Fn/Globe flag.
+var fnNames = map[string]bool{"fn": true, "globe": true}
+
+// keyNames maps key names to Keyboard/Keypad usages. Punctuation names
+// refer to the physical key at that position on a US ANSI keyboard.
+var keyNames = func() map[string]uint16 {
+	names := map[string]uint16{
+		"enter":          KeyEnter,
+		"return":         KeyEnter,
+		"esc":            KeyEscape,
+		"escape":         KeyEscape,
+		"backspace":      KeyBackspace,
+		"tab":            KeyTab,
+		"space":          KeySpace,
+		"minus":          KeyMinus,
+		"-":              KeyMinus,
+		"equal":          KeyEqual,
+		"=":              KeyEqual,
+		"leftbrace":      KeyLeftBrace,
+		"[":              KeyLeftBrace,
+		"rightbrace":     KeyRightBrace,
+		"]":              KeyRightBrace,
+		"backslash":      KeyBackslash,
+		"\\":             KeyBackslash,
+		"nonushash":      KeyNonUSHash,
+		"semicolon":      KeySemicolon,
+		";":              KeySemicolon,
+		"apostrophe":     KeyApostrophe,
+		"quote":          KeyApostrophe,
+		"'":              KeyApostrophe,
+		"grave":          KeyGrave,
+		"`":              KeyGrave,
+		"comma":          KeyComma,
+		",":              KeyComma,
+		"dot":            KeyDot,
+		"period":         KeyDot,
+		".":              KeyDot,
+		"slash":          KeySlash,
+		"/":              KeySlash,
+		"capslock":       0x39,
+		"printscreen":    0x46,
+		"scrolllock":     0x47,
+		"pause":          0x48,
+		"insert":         0x49,
+		"home":           0x4A,
+		"pageup":         0x4B,
+		"delete":         0x4C,
+		"del":            0x4C,
+		"end":            0x4D,
+		"pagedown":       0x4E,
+		"right":          0x4F,
+		"left":           0x50,
+		"down":           0x51,
+		"up":             0x52,
+		"numlock":        0x53,
+		"nonusbackslash": KeyNonUSBackslash,
+		"application":    0x65,
+		"menu":           0x65,
+		"power":          0x66,
+		"mute":           0x7F,
+		"volumeup":       0x80,
+		"volumedown":     0x81,
+	}
+	for i := 0; i < 26; i++ {
+		names[string(rune('a'+i))] = KeyA + uint16(i)
+	}
+	for i := 1; i <= 9; i++ {
+		names[strconv.Itoa(i)] = Key1 + uint16(i-1)
+	}
+	names["0"] = Key0
+	// F1-F12 are contiguous, F13-F24 start at 0x68.
+	for i := 1; i <= 12; i++ {
+		names["f"+strconv.Itoa(i)] = 0x3A + uint16(i-1)
+	}
+	for i := 13; i <= 24; i++ {
+		names["f"+strconv.Itoa(i)] = 0x68 + uint16(i-13)
+	}
+	return names
+}()
+
+// consumerNames maps consumer control names to Consumer Page usages.
+var consumerNames = map[string]uint16{
+	"power":          0x0030,
+	"sleep":          0x0032,
+	"brightnessup":   0x006F,
+	"brightnessdown": 0x0070,
+	"play":           0x00B0,
+	"pause":          0x00B1,
+	"next":           0x00B5,
+	"nexttrack":      0x00B5,
+	"prev":           0x00B6,
+	"previous":       0x00B6,
+	"prevtrack":      0x00B6,
+	"stop":           0x00B7,
+	"eject":          0x00B8,
+	"playpause":      0x00CD,
+	"mute":           0x00E2,
+	"volumeup":       0x00E9,
+	"volumedown":     0x00EA,
+	"mail":           0x018A,
+	"calculator":     0x0192,
+	"browser":        0x0196,
+	"lock":           0x019E,
+	"keyboardlayout": 0x01AE,
+	"search":         0x0221,
+	"home":           0x0223,
+	"back":           0x0224,
+	"forward":        0x0225,
+}
+
+// ParseChord parses a shortcut string.
+//
+// Keyboard chords join modifiers and at most one key with "+", e.g.
+// "cmd+shift+4", "ctrl+alt+del" or "fn+f11". Modifiers may be given alone
+// ("shift"). Consumer controls use a "media:" (or "consumer:") prefix, e.g.
+// "media:playpause". Keys and consumer controls may also be given as numeric
+// usages ("0x04", "media:0xCD"). Names are case-insensitive.
+func ParseChord(s string) (Chord, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	if text == "" {
+		return Chord{}, fmt.Errorf("empty key chord")
+	}
+	for _, prefix := range consumerPrefixes {
+		if name, ok := strings.CutPrefix(text, prefix); ok {
+			code, err := lookupUsage(strings.TrimSpace(name), consumerNames)
+			if err != nil {
+				return Chord{}, fmt.Errorf("invalid consumer control in %q: %w", s, err)
+			}
+			return Chord{Consumer: true, Code: code}, nil
+		}
+	}
+
+	var chord Chord
+	hasKey := false
+	for _, token := range splitChord(text) {
+		if token == "" {
+			return Chord{}, fmt.Errorf("invalid key chord %q: empty key name", s)
+		}
+		if bit, ok := modifierNames[token]; ok {
+			chord.Modifiers |= bit
+			continue
+		}
+		if fnNames[token] {
+			chord.AppleFn = true
+			continue
+		}
+		if hasKey {
+			return Chord{}, fmt.Errorf("invalid key chord %q: more than one non-modifier key", s)
+		}
+		code, err := lookupUsage(token, keyNames)
+		if err != nil {
+			return Chord{}, fmt.Errorf("invalid key chord %q: %w", s, err)
+		}
+		if code > 0xFF {
+			return Chord{}, fmt.Errorf("invalid key chord %q: keyboard usage must fit in uint8", s)
+		}
+		chord.Code = code
+		hasKey = true
+	}
+	return chord, nil
+}
+
+// splitChord splits a chord on "+". There is no name for the "+" key itself;
+// on a US layout it is "shift+=".
+func splitChord(text string) []string {
+	tokens := strings.Split(text, "+")
+	for i := range tokens {
+		tokens[i] = strings.TrimSpace(tokens[i])
+	}
+	return tokens
+}
+
+func lookupUsage(name string, names map[string]uint16) (uint16, error) {
+	if code, ok := names[name]; ok {
+		return code, nil
+	}
+	if strings.HasPrefix(name, "0x") {
+		code, err := strconv.ParseUint(name, 0, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid usage %q", name)
+		}
+		return uint16(code), nil
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
+
+// KeyNames returns the key names accepted by ParseChord, sorted.
+func KeyNames() []string {
+	return sortedNames(keyNames)
+}
+
+// ModifierNames returns the modifier names accepted by ParseChord, sorted.
+func ModifierNames() []string {
+	names := make([]string, 0, len(modifierNames)+len(fnNames))
+	for name := range modifierNames {
+		names = append(names, name)
+	}
+	for name := range fnNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ConsumerNames returns the consumer control names accepted by ParseChord
+// after the "media:" prefix, sorted.
+func ConsumerNames() []string {
+	return sortedNames(consumerNames)
+}
+
+func sortedNames(table map[string]uint16) []string {
+	names := make([]string, 0, len(table))
+	for name := range table {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
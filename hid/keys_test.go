@@ -0,0 +1,64 @@
+package hid_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/2opremio/keybridged/hid"
+)
+
+func TestParseChord(t *testing.T) {
+	tests := []struct {
+		chord string
+		want  hid.Chord
+	}{
+		{"cmd+shift+4", hid.Chord{Code: hid.Key1 + 3, Modifiers: hid.ModLeftGUI | hid.ModLeftShift}},
+		{"ctrl+alt+del", hid.Chord{Code: 0x4C, Modifiers: hid.ModLeftCtrl | hid.ModLeftAlt}},
+		{"fn+f11", hid.Chord{Code: 0x44, AppleFn: true}},
+		{"globe", hid.Chord{AppleFn: true}},
+		{"media:playpause", hid.Chord{Consumer: true, Code: 0xCD}},
+		{"consumer:0x0223", hid.Chord{Consumer: true, Code: 0x223}},
+		{" Ctrl + C ", hid.Chord{Code: letter('c'), Modifiers: hid.ModLeftCtrl}},
+		{"shift", hid.Chord{Modifiers: hid.ModLeftShift}},
+		{"altgr+q", hid.Chord{Code: letter('q'), Modifiers: hid.ModRightAlt}},
+		{"f13", hid.Chord{Code: 0x68}},
+		{"0x04", hid.Chord{Code: hid.KeyA}},
+		// Repeating a modifier is the same as giving it once.
+		{"shift+shift+a", hid.Chord{Code: letter('a'), Modifiers: hid.ModLeftShift}},
+		{"cmd+command+gui+tab", hid.Chord{Code: hid.KeyTab, Modifiers: hid.ModLeftGUI}},
+	}
+	for _, test := range tests {
+		got, err := hid.ParseChord(test.chord)
+		if err != nil {
+			t.Errorf("ParseChord(%q): %v", test.chord, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseChord(%q) = %+v, want %+v", test.chord, got, test.want)
+		}
+	}
+}
+
+func TestParseChordErrors(t *testing.T) {
+	tests := []struct {
+		chord string
+		want  string
+	}{
+		{"", "empty key chord"},
+		{"cmd+", "empty key name"},
+		{"+a", "empty key name"},
+		{"ctrl++c", "empty key name"},
+		{"a+b", "more than one non-modifier key"},
+		{"cmd+hyper", `unknown key "hyper"`},
+		{"media:warp", `unknown key "warp"`},
+		{"media:", `unknown key ""`},
+		{"0x1ff", "must fit in uint8"},
+		{"0xzz", `invalid usage "0xzz"`},
+	}
+	for _, test := range tests {
+		_, err := hid.ParseChord(test.chord)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseChord(%q) error = %v, want one containing %q", test.chord, err, test.want)
+		}
+	}
+}
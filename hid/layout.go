@@ -0,0 +1,243 @@
+package hid
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLayout is used when no layout name is given.
+const DefaultLayout = "us"
+
+// Keystroke is a single keyboard usage plus the modifiers needed to produce
+// a character with it.
+type Keystroke struct {
+	Code      uint16
+	Modifiers byte
+}
+
+// Layout maps characters to keystrokes for a keyboard layout configured on
+// the target host.
+//
+// The tables follow the Windows/Linux variants of each layout (AltGr is sent
+// as Right Alt). Characters that require dead keys are not supported.
+type Layout struct {
+	Name        string
+	Description string
+	strokes     map[rune]Keystroke
+}
+
+// Lookup returns the keystroke producing r.
+func (l *Layout) Lookup(r rune) (Keystroke, bool) {
+	stroke, ok := l.strokes[r]
+	return stroke, ok
+}
+
+// UnsupportedError lists the characters a layout can't produce.
+type UnsupportedError struct {
+	Layout string
+	Runes  []rune
+}
+
+func (e *UnsupportedError) Error() string {
+	quoted := make([]string, 0, len(e.Runes))
+	for _, r := range e.Runes {
+		quoted = append(quoted, strconv.QuoteRune(r))
+	}
+	return fmt.Sprintf("layout %q cannot type %s", e.Layout, strings.Join(quoted, ", "))
+}
+
+// Translate converts text into keystrokes. If some characters can't be
+// produced, it returns an *UnsupportedError listing each of them once.
+func (l *Layout) Translate(text string) ([]Keystroke, error) {
+	strokes := make([]Keystroke, 0, len(text))
+	var unsupported []rune
+	seen := make(map[rune]bool)
+	for _, r := range text {
+		stroke, ok := l.strokes[r]
+		if !ok {
+			if !seen[r] {
+				seen[r] = true
+				unsupported = append(unsupported, r)
+			}
+			continue
+		}
+		strokes = append(strokes, stroke)
+	}
+	if len(unsupported) > 0 {
+		return nil, &UnsupportedError{Layout: l.Name, Runes: unsupported}
+	}
+	return strokes, nil
+}
+
+// LookupLayout returns the named layout. An empty name selects DefaultLayout.
+func LookupLayout(name string) (*Layout, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultLayout
+	}
+	layout, ok := layouts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown layout %q (supported: %s)", name, strings.Join(LayoutNames(), ", "))
+	}
+	return layout, nil
+}
+
+// LayoutNames returns the names of the supported layouts, sorted.
+func LayoutNames() []string {
+	names := make([]string, 0, len(layouts))
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// key describes the characters one physical key produces: unshifted, with
+// Shift and with AltGr. Zero means the combination isn't typed.
+type key struct {
+	code  uint16
+	base  rune
+	shift rune
+	altGr rune
+}
+
+// newLayout builds a layout from its letter keys and the remaining keys.
+// letters lists the lowercase letter produced by each of the usages
+// KeyA..KeyA+25, in order; '_' marks a position that isn't a letter key in
+// this layout.
+func newLayout(name, description, letters string, keys []key) *Layout {
+	layout := &Layout{
+		Name:        name,
+		Description: description,
+		strokes:     make(map[rune]Keystroke),
+	}
+	add := func(r rune, code uint16, modifiers byte) {
+		if r == 0 {
+			return
+		}
+		// Keep the first (simplest) way of typing a character.
+		if _, ok := layout.strokes[r]; !ok {
+			layout.strokes[r] = Keystroke{Code: code, Modifiers: modifiers}
+		}
+	}
+	for i, r := range letters {
+		if r == '_' {
+			continue
+		}
+		code := KeyA + uint16(i)
+		add(r, code, 0)
+		add(r-'a'+'A', code, ModLeftShift)
+	}
+	for _, k := range keys {
+		add(k.base, k.code, 0)
+		add(k.shift, k.code, ModLeftShift)
+		add(k.altGr, k.code, ModRightAlt)
+	}
+	add('\n', KeyEnter, 0)
+	add('\t', KeyTab, 0)
+	add(' ', KeySpace, 0)
+	return layout
+}
+
+var layouts = map[string]*Layout{
+	"us": newLayout("us", "US ANSI (QWERTY)", "abcdefghijklmnopqrstuvwxyz", []key{
+		{Key1, '1', '!', 0},
+		{Key1 + 1, '2', '@', 0},
+		{Key1 + 2, '3', '#', 0},
+		{Key1 + 3, '4', '$', 0},
+		{Key1 + 4, '5', '%', 0},
+		{Key1 + 5, '6', '^', 0},
+		{Key1 + 6, '7', '&', 0},
+		{Key1 + 7, '8', '*', 0},
+		{Key1 + 8, '9', '(', 0},
+		{Key0, '0', ')', 0},
+		{KeyMinus, '-', '_', 0},
+		{KeyEqual, '=', '+', 0},
+		{KeyLeftBrace, '[', '{', 0},
+		{KeyRightBrace, ']', '}', 0},
+		{KeyBackslash, '\\', '|', 0},
+		{KeySemicolon, ';', ':', 0},
+		{KeyApostrophe, '\'', '"', 0},
+		{KeyGrave, '`', '~', 0},
+		{KeyComma, ',', '<', 0},
+		{KeyDot, '.', '>', 0},
+		{KeySlash, '/', '?', 0},
+	}),
+	"uk": newLayout("uk", "United Kingdom (QWERTY)", "abcdefghijklmnopqrstuvwxyz", []key{
+		{Key1, '1', '!', 0},
+		{Key1 + 1, '2', '"', 0},
+		{Key1 + 2, '3', '£', 0},
+		{Key1 + 3, '4', '$', '€'},
+		{Key1 + 4, '5', '%', 0},
+		{Key1 + 5, '6', '^', 0},
+		{Key1 + 6, '7', '&', 0},
+		{Key1 + 7, '8', '*', 0},
+		{Key1 + 8, '9', '(', 0},
+		{Key0, '0', ')', 0},
+		{KeyMinus, '-', '_', 0},
+		{KeyEqual, '=', '+', 0},
+		{KeyLeftBrace, '[', '{', 0},
+		{KeyRightBrace, ']', '}', 0},
+		{KeyNonUSHash, '#', '~', 0},
+		{KeySemicolon, ';', ':', 0},
+		{KeyApostrophe, '\'', '@', 0},
+		{KeyGrave, '`', '¬', '¦'},
+		{KeyComma, ',', '<', 0},
+		{KeyDot, '.', '>', 0},
+		{KeySlash, '/', '?', 0},
+		{KeyNonUSBackslash, '\\', '|', 0},
+	}),
+	"de": newLayout("de", "German (QWERTZ)", "abcdefghijklmnopqrstuvwxzy", []key{
+		{Key1, '1', '!', 0},
+		{Key1 + 1, '2', '"', '²'},
+		{Key1 + 2, '3', '§', '³'},
+		{Key1 + 3, '4', '$', 0},
+		{Key1 + 4, '5', '%', 0},
+		{Key1 + 5, '6', '&', 0},
+		{Key1 + 6, '7', '/', '{'},
+		{Key1 + 7, '8', '(', '['},
+		{Key1 + 8, '9', ')', ']'},
+		{Key0, '0', '=', '}'},
+		{KeyMinus, 'ß', '?', '\\'},
+		{KeyLeftBrace, 'ü', 'Ü', 0},
+		{KeyRightBrace, '+', '*', '~'},
+		{KeyNonUSHash, '#', '\'', 0},
+		{KeySemicolon, 'ö', 'Ö', 0},
+		{KeyApostrophe, 'ä', 'Ä', 0},
+		{KeyGrave, 0, '°', 0},
+		{KeyComma, ',', ';', 0},
+		{KeyDot, '.', ':', 0},
+		{KeySlash, '-', '_', 0},
+		{KeyNonUSBackslash, '<', '>', '|'},
+		{KeyA + 'q' - 'a', 0, 0, '@'},
+		{KeyA + 'e' - 'a', 0, 0, '€'},
+		{KeyA + 'm' - 'a', 0, 0, 'µ'},
+	}),
+	"fr": newLayout("fr", "French (AZERTY)", "qbcdefghijkl_noparstuvzxyw", []key{
+		{Key1, '&', '1', 0},
+		{Key1 + 1, 'é', '2', 0},
+		{Key1 + 2, '"', '3', '#'},
+		{Key1 + 3, '\'', '4', '{'},
+		{Key1 + 4, '(', '5', '['},
+		{Key1 + 5, '-', '6', '|'},
+		{Key1 + 6, 'è', '7', 0},
+		{Key1 + 7, '_', '8', '\\'},
+		{Key1 + 8, 'ç', '9', '^'},
+		{Key0, 'à', '0', '@'},
+		{KeyMinus, ')', '°', ']'},
+		{KeyEqual, '=', '+', '}'},
+		{KeyRightBrace, '$', '£', '¤'},
+		{KeyNonUSHash, '*', 'µ', 0},
+		{KeySemicolon, 'm', 'M', 0},
+		{KeyApostrophe, 'ù', '%', 0},
+		{KeyGrave, '²', 0, 0},
+		{KeyA + 'm' - 'a', ',', '?', 0},
+		{KeyComma, ';', '.', 0},
+		{KeyDot, ':', '/', 0},
+		{KeySlash, '!', '§', 0},
+		{KeyNonUSBackslash, '<', '>', 0},
+		{KeyA + 'e' - 'a', 0, 0, '€'},
+	}),
+}
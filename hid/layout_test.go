@@ -0,0 +1,103 @@
+package hid_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/2opremio/keybridged/hid"
+)
+
+// letter returns the usage of the key labelled r on a US keyboard.
+func letter(r rune) uint16 {
+	return hid.KeyA + uint16(r-'a')
+}
+
+func TestLayoutSpotChecks(t *testing.T) {
+	tests := []struct {
+		layout string
+		char   rune
+		want   hid.Keystroke
+	}{
+		{"us", 'a', hid.Keystroke{Code: letter('a')}},
+		{"us", 'A', hid.Keystroke{Code: letter('a'), Modifiers: hid.ModLeftShift}},
+		{"us", '@', hid.Keystroke{Code: hid.Key1 + 1, Modifiers: hid.ModLeftShift}},
+		{"us", '\n', hid.Keystroke{Code: hid.KeyEnter}},
+		{"uk", '@', hid.Keystroke{Code: hid.KeyApostrophe, Modifiers: hid.ModLeftShift}},
+		{"uk", '#', hid.Keystroke{Code: hid.KeyNonUSHash}},
+		{"uk", '£', hid.Keystroke{Code: hid.Key1 + 2, Modifiers: hid.ModLeftShift}},
+		{"uk", '€', hid.Keystroke{Code: hid.Key1 + 3, Modifiers: hid.ModRightAlt}},
+		{"de", 'y', hid.Keystroke{Code: letter('z')}},
+		{"de", 'z', hid.Keystroke{Code: letter('y')}},
+		{"de", 'Z', hid.Keystroke{Code: letter('y'), Modifiers: hid.ModLeftShift}},
+		{"de", 'ß', hid.Keystroke{Code: hid.KeyMinus}},
+		{"de", '@', hid.Keystroke{Code: letter('q'), Modifiers: hid.ModRightAlt}},
+		{"de", '€', hid.Keystroke{Code: letter('e'), Modifiers: hid.ModRightAlt}},
+		{"de", '{', hid.Keystroke{Code: hid.Key1 + 6, Modifiers: hid.ModRightAlt}},
+		{"fr", 'a', hid.Keystroke{Code: letter('q')}},
+		{"fr", 'q', hid.Keystroke{Code: letter('a')}},
+		{"fr", 'z', hid.Keystroke{Code: letter('w')}},
+		{"fr", 'm', hid.Keystroke{Code: hid.KeySemicolon}},
+		{"fr", 'M', hid.Keystroke{Code: hid.KeySemicolon, Modifiers: hid.ModLeftShift}},
+		{"fr", ',', hid.Keystroke{Code: letter('m')}},
+		{"fr", '1', hid.Keystroke{Code: hid.Key1, Modifiers: hid.ModLeftShift}},
+		{"fr", '@', hid.Keystroke{Code: hid.Key0, Modifiers: hid.ModRightAlt}},
+		{"fr", '€', hid.Keystroke{Code: letter('e'), Modifiers: hid.ModRightAlt}},
+	}
+	for _, test := range tests {
+		layout, err := hid.LookupLayout(test.layout)
+		if err != nil {
+			t.Fatalf("LookupLayout(%q): %v", test.layout, err)
+		}
+		got, ok := layout.Lookup(test.char)
+		if !ok || got != test.want {
+			t.Errorf("%s: Lookup(%q) = %+v, %v, want %+v", test.layout, test.char, got, ok, test.want)
+		}
+	}
+}
+
+func TestLayoutUnsupported(t *testing.T) {
+	tests := []struct {
+		layout string
+		text   string
+		want   []rune
+	}{
+		// Characters that need a dead key.
+		{"de", "^2", []rune{'^'}},
+		{"de", "café", []rune{'é'}},
+		{"fr", "fête", []rune{'ê'}},
+		{"uk", "naïve", []rune{'ï'}},
+		// Characters the layout doesn't have, each listed once.
+		{"us", "£1 €2 £3", []rune{'£', '€'}},
+		{"fr", "a😀b😀", []rune{'😀'}},
+	}
+	for _, test := range tests {
+		layout, err := hid.LookupLayout(test.layout)
+		if err != nil {
+			t.Fatalf("LookupLayout(%q): %v", test.layout, err)
+		}
+		strokes, err := layout.Translate(test.text)
+		var unsupported *hid.UnsupportedError
+		if !errors.As(err, &unsupported) {
+			t.Errorf("%s: Translate(%q) = %v, %v, want *UnsupportedError", test.layout, test.text, strokes, err)
+			continue
+		}
+		if unsupported.Layout != test.layout || !slices.Equal(unsupported.Runes, test.want) {
+			t.Errorf("%s: Translate(%q) error = %+v, want runes %q", test.layout, test.text, unsupported, test.want)
+		}
+	}
+}
+
+func TestLookupLayout(t *testing.T) {
+	for _, name := range []string{"", " DE ", "fr"} {
+		if _, err := hid.LookupLayout(name); err != nil {
+			t.Errorf("LookupLayout(%q): %v", name, err)
+		}
+	}
+	if layout, _ := hid.LookupLayout(""); layout.Name != hid.DefaultLayout {
+		t.Errorf("LookupLayout(\"\") = %s, want %s", layout.Name, hid.DefaultLayout)
+	}
+	if _, err := hid.LookupLayout("dvorak"); err == nil {
+		t.Error("LookupLayout(\"dvorak\") succeeded")
+	}
+}